@@ -1,17 +1,13 @@
 import asyncio
-import json
 import logging
-import aio_pika
 from dataclasses import dataclass
 from fastapi import Depends, FastAPI, Header, HTTPException, Query, Request
 from fastapi.middleware.cors import CORSMiddleware
 from fastapi.responses import JSONResponse
 from typing import List, Optional
-from src.config import settings
 from src.models.appointment import (
     CreateAppointmentRequest,
     AppointmentServiceRequest,
-    AppointmentBookedEvent,
     AppointmentResponse,
 )
 from src.services import auth, appointment as appointment_service
@@ -56,54 +52,6 @@ async def require_auth(authorization: str = Header(...)) -> AuthContext:
     )
 
 
-# ─── RabbitMQ helper ──────────────────────────────────────────────────────────
-
-PUBLISH_MAX_RETRIES = 3
-PUBLISH_RETRY_DELAY = 0.5  # seconds, doubles each attempt
-
-
-async def publish_event(routing_key: str, payload: dict):
-    """Publish an event to the clinic topic exchange with retry.
-
-    Retries up to 3 times with exponential backoff. If all attempts fail,
-    raises an HTTPException so the caller can decide how to handle it
-    (e.g. warn the client instead of silently losing the event).
-    """
-    last_error: Exception | None = None
-    for attempt in range(PUBLISH_MAX_RETRIES):
-        try:
-            connection = await aio_pika.connect_robust(settings.RABBITMQ_URL)
-            async with connection:
-                channel = await connection.channel()
-                exchange = await channel.declare_exchange(
-                    "clinic.events",
-                    aio_pika.ExchangeType.TOPIC,
-                    durable=True,
-                )
-                await exchange.publish(
-                    aio_pika.Message(
-                        body=json.dumps(payload).encode(),
-                        content_type="application/json",
-                    ),
-                    routing_key=routing_key,
-                )
-            return  # success
-        except Exception as e:
-            last_error = e
-            delay = PUBLISH_RETRY_DELAY * (2 ** attempt)
-            logger.warning(
-                "[RabbitMQ] Publish %s attempt %d/%d failed: %s. Retrying in %.1fs...",
-                routing_key, attempt + 1, PUBLISH_MAX_RETRIES, e, delay,
-            )
-            await asyncio.sleep(delay)
-
-    logger.error("[RabbitMQ] Publish %s failed after %d attempts: %s", routing_key, PUBLISH_MAX_RETRIES, last_error)
-    raise HTTPException(
-        status_code=503,
-        detail=f"Event bus unavailable — {routing_key} could not be published after {PUBLISH_MAX_RETRIES} retries",
-    )
-
-
 # ─── Routes ───────────────────────────────────────────────────────────────────
 
 @app.get("/health")
@@ -155,7 +103,15 @@ async def create_appointment(
         appt = await appointment_service.create_appointment(
             AppointmentServiceRequest(**body.model_dump(exclude={"slot_id"})),
             auth_ctx.token,
+            idempotency_key=x_idempotency_key,
         )
+        # appointment-service replays the original booking for a reused key; if that booking
+        # was rolled back below on an earlier attempt, the key can't be used again.
+        if appt.status == "cancelled":
+            raise HTTPException(
+                status_code=409,
+                detail="This idempotency key belongs to a booking that was rolled back. Please retry with a new key.",
+            )
     except Exception:
         # Appointment creation failed — release the reservation so the client
         # can retry immediately with the same idempotency key.
@@ -163,58 +119,30 @@ async def create_appointment(
             await clear_idempotency_reservation(auth_ctx.user_id, x_idempotency_key)
         raise
 
-    event_payload = AppointmentBookedEvent(
-        appointment_id=appt.id,
-        patient_id=appt.patient_id,
-        doctor_id=appt.doctor_id,
-        start_time=appt.start_time,
-        session=appt.session,
-    ).model_dump(mode="json")
-
     if body.slot_id:
-        # Claim the slot first — only publish the event once we know the slot is ours.
-        # Running both concurrently (asyncio.gather) risks publishing appointment.booked
-        # for a slot that is then rejected with 409.
+        # appointment-service has already written appointment.booked to its outbox, so a
+        # rolled-back booking is followed by appointment.cancelled for downstream consumers.
         try:
             await appointment_service.mark_slot_booked(body.slot_id, auth_ctx.token)
         except Exception as e:
             # Roll back the appointment for any slot-claim failure (409 conflict,
             # 5xx, timeout) so we never leave an orphaned appointment row.
             try:
-                await appointment_service.cancel_appointment(appt.id, auth_ctx.token)
-            except Exception:
-                pass
+                await appointment_service.cancel_appointment(
+                    appt.id, auth_ctx.token, "system_rollback",
+                    f"could not claim time slot {body.slot_id}",
+                )
+            except Exception as rollback_err:
+                logger.error(
+                    "[Rollback] failed to cancel appointment %s after slot %s could not be claimed: %s",
+                    appt.id, body.slot_id, rollback_err,
+                )
             if x_idempotency_key:
                 await clear_idempotency_reservation(auth_ctx.user_id, x_idempotency_key)
             if isinstance(e, HTTPException) and e.status_code == 409:
                 raise HTTPException(status_code=409, detail="This time slot was just booked by someone else. Please choose another.")
             raise
 
-    try:
-        await publish_event("appointment.booked", event_payload)
-    except HTTPException as e:
-        if e.status_code == 503:
-            # Event bus is down — roll back so the patient doesn't end up with
-            # a persisted appointment but no queue entry or downstream notifications.
-            logger.error("Event publish failed for appointment %s — rolling back", appt.id)
-            try:
-                await appointment_service.cancel_appointment(appt.id, auth_ctx.token)
-                if body.slot_id:
-                    await appointment_service.release_slot(
-                        appt.doctor_id,
-                        appt.start_time.isoformat() if appt.start_time else "",
-                        auth_ctx.token,
-                    )
-            except Exception:
-                pass
-            if x_idempotency_key:
-                await clear_idempotency_reservation(auth_ctx.user_id, x_idempotency_key)
-            raise HTTPException(
-                status_code=503,
-                detail="Booking service is temporarily unavailable — please try again in a moment.",
-            )
-        raise
-
     response = appt.model_dump(mode="json")
 
     if x_idempotency_key:
@@ -249,7 +177,7 @@ async def cancel_appointment(
     if existing.patient_id != auth_ctx.user_id:
         raise HTTPException(status_code=403, detail="Forbidden")
 
-    appt = await appointment_service.cancel_appointment(appointment_id, auth_ctx.token)
+    appt = await appointment_service.cancel_appointment(appointment_id, auth_ctx.token, "patient_request")
 
     # Release the doctor's time slot if this was a specific-doctor booking.
     # Retry a few times — if all attempts fail the slot stays marked booked
@@ -269,17 +197,4 @@ async def cancel_appointment(
                 else:
                     await asyncio.sleep(0.5 * (2 ** attempt))
 
-    try:
-        await publish_event("appointment.cancelled", {
-            "appointment_id": appointment_id,
-            "patient_id": appt.patient_id,
-            "doctor_id": appt.doctor_id,
-            "start_time": appt.start_time.isoformat() if appt.start_time else None,
-        })
-    except HTTPException as e:
-        if e.status_code == 503:
-            logger.error("Event publish failed for cancellation %s — queue may not update", appointment_id)
-        else:
-            raise
-
     return appt
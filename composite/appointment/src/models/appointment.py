@@ -1,8 +1,13 @@
 from pydantic import BaseModel, model_validator
-from datetime import datetime
+from datetime import date, datetime
 from typing import Literal
 
 
+CancellationReason = Literal[
+    "patient_request", "clinic_closure", "doctor_unavailable", "system_rollback", "duplicate"
+]
+
+
 # ─── Incoming from frontend ──────────────────────────────────
 
 class CreateAppointmentRequest(BaseModel):
@@ -10,6 +15,7 @@ class CreateAppointmentRequest(BaseModel):
     doctor_id: str | None = None
     start_time: datetime | None = None                       # required for specific doctor bookings
     session: Literal["morning", "afternoon"] | None = None  # required for generic bookings
+    appointment_date: date | None = None                    # required for generic bookings
     slot_id: str | None = None                              # time slot to mark as booked
     notes: str | None = None
 
@@ -21,6 +27,8 @@ class CreateAppointmentRequest(BaseModel):
             raise ValueError("provide either session (morning/afternoon) or start_time+doctor_id")
         if self.start_time and not self.doctor_id:
             raise ValueError("doctor_id is required when start_time is provided")
+        if self.session and not self.appointment_date:
+            raise ValueError("appointment_date is required for session bookings")
         return self
 
 
@@ -31,19 +39,10 @@ class AppointmentServiceRequest(BaseModel):
     doctor_id: str | None = None
     start_time: datetime | None = None
     session: str | None = None
+    appointment_date: date | None = None
     notes: str | None = None
 
 
-# ─── Sent to downstream services (via RabbitMQ) ──────────────
-
-class AppointmentBookedEvent(BaseModel):
-    appointment_id: str
-    patient_id: str
-    doctor_id: str | None = None
-    start_time: datetime | None = None
-    session: str | None = None
-
-
 # ─── Returned to frontend ────────────────────────────────────
 
 class AppointmentResponse(BaseModel):
@@ -52,10 +51,14 @@ class AppointmentResponse(BaseModel):
     doctor_id: str | None = None
     start_time: datetime | None = None
     session: str | None = None
+    appointment_date: date | None = None
     estimated_time: datetime | None = None  # set later by ETA service
     queue_position: int | None = None       # set later by queue coordinator
     notes: str | None = None
     status: str
     created_at: datetime
     updated_at: datetime
-    warning: str | None = None  # set when event-bus publish fails at booking time
+    cancellation_reason: CancellationReason | None = None
+    cancellation_note: str | None = None
+    cancelled_by: str | None = None
+    cancelled_at: datetime | None = None
@@ -2,7 +2,7 @@ import httpx
 from fastapi import HTTPException
 from typing import Literal, NoReturn
 from src.config import settings
-from src.models.appointment import AppointmentServiceRequest, AppointmentResponse
+from src.models.appointment import AppointmentServiceRequest, AppointmentResponse, CancellationReason
 
 
 def _forward_error(e: httpx.HTTPStatusError) -> NoReturn:
@@ -27,7 +27,9 @@ async def _call(
         headers={"Authorization": f"Bearer {token}"},
         timeout=10.0,
     ) as client:
-        response = await getattr(client, method)(path, **kwargs)
+        # request() rather than client.<method>(): httpx's delete() takes no body, but
+        # cancellations send their reason as JSON
+        response = await client.request(method.upper(), path, **kwargs)
         try:
             response.raise_for_status()
         except httpx.HTTPStatusError as e:
@@ -35,22 +37,43 @@ async def _call(
         return response
 
 
+async def _list_all(params: dict, token: str) -> list[AppointmentResponse]:
+    """Follow appointment-service's list cursor until every matching page is fetched."""
+    appointments: list[AppointmentResponse] = []
+    params = {**params, "limit": 200}
+    while True:
+        page = (await _call("get", "/appointments", token, params=params)).json()
+        appointments.extend(AppointmentResponse(**a) for a in page["items"])
+        if not page.get("next_cursor"):
+            return appointments
+        params["cursor"] = page["next_cursor"]
+
+
 async def list_appointments_by_doctor(doctor_id: str, token: str) -> list[AppointmentResponse]:
     """List all appointments for a doctor from atomic appointment-service."""
-    response = await _call("get", "/appointments", token, params={"doctor_id": doctor_id})
-    return [AppointmentResponse(**a) for a in response.json() or []]
+    return await _list_all({"doctor_id": doctor_id}, token)
 
 
 async def list_appointments(patient_id: str, token: str) -> list[AppointmentResponse]:
     """List all appointments for a patient from atomic appointment-service."""
-    response = await _call("get", "/appointments", token, params={"patient_id": patient_id})
-    return [AppointmentResponse(**a) for a in response.json() or []]
+    return await _list_all({"patient_id": patient_id}, token)
 
 
-async def create_appointment(data: AppointmentServiceRequest, token: str) -> AppointmentResponse:
-    """Call atomic appointment-service to create an appointment."""
-    response = await _call("post", "/appointments", token, json=data.model_dump(mode="json"))
-    return AppointmentResponse(**response.json())
+async def create_appointment(
+    data: AppointmentServiceRequest, token: str, idempotency_key: str | None = None
+) -> AppointmentResponse:
+    """Call atomic appointment-service to create an appointment.
+
+    With an idempotency key, a retry after a timeout returns the original booking
+    instead of creating a second one. A replayed response is the booking as it was
+    created, so its current state is fetched instead.
+    """
+    headers = {"Idempotency-Key": idempotency_key} if idempotency_key else None
+    response = await _call("post", "/appointments", token, json=data.model_dump(mode="json"), headers=headers)
+    appt = AppointmentResponse(**response.json())
+    if response.headers.get("Idempotent-Replayed") == "true":
+        return await get_appointment(appt.id, token)
+    return appt
 
 
 async def get_appointment(appointment_id: str, token: str) -> AppointmentResponse:
@@ -59,9 +82,17 @@ async def get_appointment(appointment_id: str, token: str) -> AppointmentRespons
     return AppointmentResponse(**response.json())
 
 
-async def cancel_appointment(appointment_id: str, token: str) -> AppointmentResponse:
-    """Cancel an appointment via atomic appointment-service."""
-    response = await _call("delete", f"/appointments/{appointment_id}", token)
+async def cancel_appointment(
+    appointment_id: str,
+    token: str,
+    reason_code: CancellationReason,
+    reason: str | None = None,
+) -> AppointmentResponse:
+    """Cancel an appointment via atomic appointment-service, recording why."""
+    response = await _call(
+        "delete", f"/appointments/{appointment_id}", token,
+        json={"reason_code": reason_code, "reason": reason},
+    )
     return AppointmentResponse(**response.json())
 
 
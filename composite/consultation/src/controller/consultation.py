@@ -6,7 +6,7 @@ Implements the Scenario 3 flow from the architecture diagram:
        Returns cached result immediately if already completed.
   1. → gRPC POST MC + prescribed medication to patient-service (idempotent)
   2. → gRPC POST consultation notes to doctor-service (idempotent)
-  3. → HTTP PATCH mark appointment as complete via appointment-service
+  3. → HTTP PATCH appointment through in_progress to completed via appointment-service
   4. → gRPC to Stripe Wrapper to create payment session
        (Stripe Wrapper publishes payment.pending independently)
   5. → Publish "consultation.completed" event to RabbitMQ
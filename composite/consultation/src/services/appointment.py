@@ -36,12 +36,39 @@ async def _call(
         return response
 
 
+# appointment-service only allows scheduled → checked_in → in_progress → completed, one
+# step at a time. The doctor is with the patient, so any steps still missing are taken here;
+# checked_in is not one of them, since only a kiosk check-in can set it.
+_STEPS_TO_COMPLETED = {
+    "checked_in": ["in_progress", "completed"],
+    "in_progress": ["completed"],
+    "completed": [],
+}
+
+
 async def mark_complete(appointment_id: str, token: str) -> dict:
-    """PATCH appointment status to 'completed'."""
-    response = await _call(
-        "patch",
-        f"/appointments/{appointment_id}/status",
-        token,
-        json={"status": "completed"},
-    )
-    return response.json()
+    """Move the appointment to 'completed' through the statuses it hasn't reached yet.
+
+    Safe to retry: an appointment that is already completed is returned unchanged.
+    """
+    appointment = (await _call("get", f"/appointments/{appointment_id}", token)).json()
+    if appointment["status"] == "scheduled":
+        raise HTTPException(
+            status_code=409,
+            detail="Patient has not checked in for this appointment",
+        )
+    steps = _STEPS_TO_COMPLETED.get(appointment["status"])
+    if steps is None:
+        raise HTTPException(
+            status_code=409,
+            detail=f"Appointment is {appointment['status']} and cannot be completed",
+        )
+    for status in steps:
+        response = await _call(
+            "patch",
+            f"/appointments/{appointment_id}/status",
+            token,
+            json={"status": status},
+        )
+        appointment = response.json()
+    return appointment
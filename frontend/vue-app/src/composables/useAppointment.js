@@ -44,7 +44,9 @@ function formatAppointmentDate(appt) {
       weekday: 'short', day: 'numeric', month: 'short', year: 'numeric',
     })
   }
-  return new Date().toLocaleDateString('en-SG', {
+  // session bookings carry their clinic day (SGT) instead of a start time
+  const day = appt.appointment_date ? new Date(`${appt.appointment_date}T00:00:00+08:00`) : new Date()
+  return day.toLocaleDateString('en-SG', {
     weekday: 'short', day: 'numeric', month: 'short', year: 'numeric',
   })
 }
@@ -0,0 +1,10 @@
+-- Restrict appointments.status to the lifecycle values understood by appointment-service.
+-- Transitions between them are enforced in the service (models.statusTransitions).
+
+ALTER TABLE appointments.appointments
+    DROP CONSTRAINT IF EXISTS appointments_status_valid;
+
+ALTER TABLE appointments.appointments
+    ADD CONSTRAINT appointments_status_valid CHECK (
+        status IN ('scheduled', 'checked_in', 'in_progress', 'completed', 'cancelled', 'no_show')
+    );
@@ -0,0 +1,30 @@
+-- Append-only audit trail for appointment mutations.
+-- appointment-service writes one row per create, status change, cancel and reschedule
+-- in the same transaction as the change itself. Rows are never updated or deleted.
+
+CREATE TABLE IF NOT EXISTS appointments.appointment_events (
+    id             BIGSERIAL   PRIMARY KEY,
+    appointment_id UUID        NOT NULL REFERENCES appointments.appointments(id),
+    event_type     TEXT        NOT NULL
+        CHECK (event_type IN ('created', 'status_changed', 'cancelled', 'rescheduled')),
+    actor_id       TEXT,       -- user_id (JWT sub) of the caller; null for system changes
+    old_value      JSONB,
+    new_value      JSONB,
+    reason         TEXT,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_appointment_events_appointment
+    ON appointments.appointment_events(appointment_id, created_at);
+
+CREATE OR REPLACE FUNCTION appointments.reject_event_mutation()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'appointment_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_appointment_events_append_only ON appointments.appointment_events;
+CREATE TRIGGER trg_appointment_events_append_only
+    BEFORE UPDATE OR DELETE ON appointments.appointment_events
+    FOR EACH ROW EXECUTE FUNCTION appointments.reject_event_mutation();
@@ -0,0 +1,14 @@
+-- Per-date capacity for session-based (morning/afternoon) bookings.
+-- Dates without a row fall back to appointment-service's SESSION_CAPACITY_DEFAULT.
+
+CREATE TABLE IF NOT EXISTS appointments.session_capacity (
+    session_date DATE        NOT NULL,
+    session      TEXT        NOT NULL CHECK (session IN ('morning', 'afternoon')),
+    capacity     INT         NOT NULL CHECK (capacity >= 0),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (session_date, session)
+);
+
+CREATE INDEX IF NOT EXISTS idx_appointments_session_created
+    ON appointments.appointments(session, created_at)
+    WHERE session IS NOT NULL AND status NOT IN ('cancelled', 'no_show', 'completed');
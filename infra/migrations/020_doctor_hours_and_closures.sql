@@ -0,0 +1,19 @@
+-- Booking calendar for appointment-service.
+-- doctor_working_hours: weekly windows (clinic time) in which a doctor takes bookings.
+--   Doctors with no rows fall back to the default session hours, Monday to Saturday.
+-- clinic_closures: dates the whole clinic is closed, e.g. public holidays.
+
+CREATE TABLE IF NOT EXISTS appointments.doctor_working_hours (
+    doctor_id  TEXT     NOT NULL REFERENCES appointments.doctors(id) ON DELETE CASCADE,
+    weekday    SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),  -- 0 = Sunday
+    start_time TIME     NOT NULL,
+    end_time   TIME     NOT NULL,
+    PRIMARY KEY (doctor_id, weekday, start_time),
+    CONSTRAINT working_hours_valid CHECK (end_time > start_time)
+);
+
+CREATE TABLE IF NOT EXISTS appointments.clinic_closures (
+    closure_date DATE        PRIMARY KEY,
+    reason       TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,30 @@
+-- Per-doctor slot length and default appointment duration, plus an end_time on each
+-- specific-doctor booking so capacity can be checked by overlapping intervals rather than
+-- equal start times.
+
+ALTER TABLE appointments.doctors
+    ADD COLUMN IF NOT EXISTS slot_minutes INT NOT NULL DEFAULT 15
+        CHECK (slot_minutes BETWEEN 5 AND 240),
+    ADD COLUMN IF NOT EXISTS default_duration_minutes INT NOT NULL DEFAULT 15
+        CHECK (default_duration_minutes > 0);
+
+ALTER TABLE appointments.appointments
+    ADD COLUMN IF NOT EXISTS end_time TIMESTAMPTZ;
+
+-- Existing bookings were all single 15 minute slots.
+UPDATE appointments.appointments
+SET end_time = start_time + INTERVAL '15 minutes'
+WHERE start_time IS NOT NULL AND end_time IS NULL;
+
+ALTER TABLE appointments.appointments
+    DROP CONSTRAINT IF EXISTS appointment_interval_valid;
+ALTER TABLE appointments.appointments
+    ADD CONSTRAINT appointment_interval_valid CHECK (
+        (start_time IS NULL AND end_time IS NULL)
+        OR
+        (start_time IS NOT NULL AND end_time > start_time)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_appointments_doctor_interval
+    ON appointments.appointments(doctor_id, start_time, end_time)
+    WHERE status NOT IN ('cancelled', 'no_show', 'completed');
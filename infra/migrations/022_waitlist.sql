@@ -0,0 +1,59 @@
+-- Waitlist for full doctor slots and sessions. When a cancellation, no-show or reschedule
+-- frees capacity, appointment-service books the earliest eligible entry in the same
+-- transaction and records a waitlist_promoted event on the new appointment.
+--
+-- Joining and leaving are recorded in appointment_events too. Those rows have no
+-- appointment yet, so they name the waitlist entry instead; promotions name both.
+
+CREATE TABLE IF NOT EXISTS appointments.waitlist_entries (
+    id               UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    patient_id       TEXT        NOT NULL,
+    doctor_id        TEXT        REFERENCES appointments.doctors(id),
+    start_time       TIMESTAMPTZ,
+    duration_minutes INT,
+    session          TEXT        CHECK (session IN ('morning', 'afternoon')),
+    session_date     DATE,
+    notes            TEXT,
+    status           TEXT        NOT NULL DEFAULT 'waiting'
+        CHECK (status IN ('waiting', 'promoted', 'cancelled')),
+    appointment_id   UUID        REFERENCES appointments.appointments(id),
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    promoted_at      TIMESTAMPTZ,
+    CONSTRAINT waitlist_type_valid CHECK (
+        (session IS NOT NULL AND session_date IS NOT NULL AND start_time IS NULL AND doctor_id IS NULL)
+        OR
+        (session IS NULL AND session_date IS NULL AND start_time IS NOT NULL AND doctor_id IS NOT NULL
+            AND duration_minutes > 0)
+    )
+);
+
+-- One waiting entry per patient per slot / session.
+CREATE UNIQUE INDEX IF NOT EXISTS uq_waitlist_doctor_slot
+    ON appointments.waitlist_entries(patient_id, doctor_id, start_time)
+    WHERE status = 'waiting' AND doctor_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_waitlist_session
+    ON appointments.waitlist_entries(patient_id, session, session_date)
+    WHERE status = 'waiting' AND session IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_waitlist_doctor_waiting
+    ON appointments.waitlist_entries(doctor_id, start_time, created_at)
+    WHERE status = 'waiting';
+
+ALTER TABLE appointments.appointment_events
+    ALTER COLUMN appointment_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS waitlist_entry_id UUID REFERENCES appointments.waitlist_entries(id);
+ALTER TABLE appointments.appointment_events
+    DROP CONSTRAINT IF EXISTS appointment_events_event_type_check,
+    DROP CONSTRAINT IF EXISTS appointment_events_subject_check;
+ALTER TABLE appointments.appointment_events
+    ADD CONSTRAINT appointment_events_event_type_check CHECK (
+        event_type IN ('created', 'status_changed', 'cancelled', 'rescheduled',
+                       'waitlist_joined', 'waitlist_left', 'waitlist_promoted')
+    ),
+    ADD CONSTRAINT appointment_events_subject_check CHECK (
+        appointment_id IS NOT NULL OR waitlist_entry_id IS NOT NULL
+    );
+
+CREATE INDEX IF NOT EXISTS idx_appointment_events_waitlist_entry
+    ON appointments.appointment_events(waitlist_entry_id, created_at)
+    WHERE waitlist_entry_id IS NOT NULL;
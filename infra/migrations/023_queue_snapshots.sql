@@ -0,0 +1,9 @@
+-- Last applied queue snapshot version per queue, so PUT /appointments/queue-snapshot can
+-- reject snapshots older than the one already written.
+-- queue_key is 'doctor:<doctor_id>:<date>' or 'session:<session>:<date>'.
+
+CREATE TABLE IF NOT EXISTS appointments.queue_snapshot_versions (
+    queue_key  TEXT        PRIMARY KEY,
+    version    BIGINT      NOT NULL CHECK (version > 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
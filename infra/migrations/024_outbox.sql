@@ -0,0 +1,19 @@
+-- Transactional outbox for appointment events. Handlers insert a row in the same
+-- transaction as the change; appointment-service's relay publishes pending rows to the
+-- clinic.events exchange in seq order, using id as the AMQP message-id for deduplication.
+
+CREATE TABLE IF NOT EXISTS appointments.outbox (
+    seq          BIGSERIAL   PRIMARY KEY,
+    id           UUID        NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+    aggregate_id UUID        NOT NULL,  -- appointment the event is about
+    routing_key  TEXT        NOT NULL,
+    payload      JSONB       NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ,
+    attempts     INT         NOT NULL DEFAULT 0,
+    last_error   TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending
+    ON appointments.outbox(seq)
+    WHERE published_at IS NULL;
@@ -0,0 +1,12 @@
+-- Events appointment-service has consumed from clinic.events. The consumer inserts the
+-- event ID in the same transaction as the status change it applies, so a redelivered
+-- message is recognised and skipped. Rows older than PROCESSED_EVENT_RETENTION are pruned.
+
+CREATE TABLE IF NOT EXISTS appointments.processed_events (
+    event_id     TEXT        PRIMARY KEY,  -- AMQP message-id, or sha256 of routing key + body
+    routing_key  TEXT        NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_events_processed_at
+    ON appointments.processed_events (processed_at);
@@ -0,0 +1,17 @@
+-- Idempotency-Key records for POST /appointments. A key is scoped to the caller and stores
+-- a hash of the request with the response it produced, so a retried request replays the
+-- original 201 instead of booking twice. Rows are written in the booking's transaction.
+
+CREATE TABLE IF NOT EXISTS appointments.idempotency_keys (
+    key          TEXT        NOT NULL,
+    actor_id     TEXT        NOT NULL,  -- JWT sub of the caller
+    request_hash TEXT        NOT NULL,  -- sha256 of the decoded request body
+    status_code  INT,
+    response     JSONB,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at   TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (key, actor_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires
+    ON appointments.idempotency_keys(expires_at);
@@ -0,0 +1,7 @@
+-- Keyset index for the paginated GET /appointments ordered by created_at, with id as the
+-- tie-breaker. sort=start_time places session bookings at their session start in the clinic
+-- time zone, which is a query parameter, so no index serves it; the patient and doctor
+-- filters keep those sorts small.
+
+CREATE INDEX IF NOT EXISTS idx_appointments_created_id
+    ON appointments.appointments(created_at, id);
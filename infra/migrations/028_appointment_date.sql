@@ -0,0 +1,25 @@
+-- The clinic day a session booking is for. Session bookings have no start_time, so until
+-- now their day was inferred from created_at, which only worked for same-day walk-ins.
+-- Specific-doctor bookings keep appointment_date NULL; their day comes from start_time.
+
+ALTER TABLE appointments.appointments
+    ADD COLUMN IF NOT EXISTS appointment_date DATE;
+
+-- Existing session bookings were all same-day, in the default clinic timezone.
+UPDATE appointments.appointments
+SET appointment_date = (created_at AT TIME ZONE 'Asia/Singapore')::date
+WHERE session IS NOT NULL AND appointment_date IS NULL;
+
+ALTER TABLE appointments.appointments
+    DROP CONSTRAINT IF EXISTS booking_type_valid;
+ALTER TABLE appointments.appointments
+    ADD CONSTRAINT booking_type_valid CHECK (
+        (session IS NOT NULL AND appointment_date IS NOT NULL AND start_time IS NULL AND doctor_id IS NULL)
+        OR
+        (session IS NULL AND appointment_date IS NULL AND start_time IS NOT NULL AND doctor_id IS NOT NULL)
+    );
+
+DROP INDEX IF EXISTS appointments.idx_appointments_session_created;
+CREATE INDEX IF NOT EXISTS idx_appointments_session_date
+    ON appointments.appointments(session, appointment_date)
+    WHERE session IS NOT NULL AND status NOT IN ('cancelled', 'no_show', 'completed');
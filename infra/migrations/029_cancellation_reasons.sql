@@ -0,0 +1,30 @@
+-- Why and by whom an appointment was cancelled, so cancellation causes can be reported on.
+-- cancellation_reason is a fixed code; cancellation_note is the caller's free text.
+
+ALTER TABLE appointments.appointments
+    ADD COLUMN IF NOT EXISTS cancellation_reason TEXT,
+    ADD COLUMN IF NOT EXISTS cancellation_note   TEXT,
+    ADD COLUMN IF NOT EXISTS cancelled_by        TEXT,
+    ADD COLUMN IF NOT EXISTS cancelled_at        TIMESTAMPTZ;
+
+ALTER TABLE appointments.appointments
+    DROP CONSTRAINT IF EXISTS cancellation_reason_valid;
+ALTER TABLE appointments.appointments
+    ADD CONSTRAINT cancellation_reason_valid CHECK (
+        cancellation_reason IN ('patient_request', 'clinic_closure', 'doctor_unavailable', 'system_rollback', 'duplicate')
+    );
+
+-- Earlier cancellations have no code; take the actor, time and note from their history.
+UPDATE appointments.appointments a
+SET cancelled_by = e.actor_id, cancelled_at = e.created_at, cancellation_note = e.reason
+FROM (
+    SELECT DISTINCT ON (appointment_id) appointment_id, actor_id, created_at, reason
+    FROM appointments.appointment_events
+    WHERE event_type = 'cancelled'
+    ORDER BY appointment_id, created_at DESC
+) e
+WHERE a.id = e.appointment_id AND a.status = 'cancelled' AND a.cancelled_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_appointments_cancellation_reason
+    ON appointments.appointments(cancellation_reason, cancelled_at)
+    WHERE status = 'cancelled';
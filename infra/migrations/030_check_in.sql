@@ -0,0 +1,18 @@
+-- When an appointment was checked in, whether that was at a front-desk kiosk (which verifies
+-- the patient is present), and whether the patient arrived late. checked_in_late is only
+-- known for kiosk check-ins of doctor bookings; session bookings have no start to be late for.
+
+ALTER TABLE appointments.appointments
+    ADD COLUMN IF NOT EXISTS checked_in_at    TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS checked_in_kiosk BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS checked_in_late  BOOLEAN;
+
+UPDATE appointments.appointments a
+SET checked_in_at = e.created_at
+FROM (
+    SELECT appointment_id, MIN(created_at) AS created_at
+    FROM appointments.appointment_events
+    WHERE event_type = 'status_changed' AND new_value->>'status' = 'checked_in'
+    GROUP BY appointment_id
+) e
+WHERE a.id = e.appointment_id AND a.checked_in_at IS NULL;
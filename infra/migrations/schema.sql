@@ -1,6 +1,6 @@
 -- Full schema for Smart Clinic Queue system.
 -- Run once against a fresh Supabase database.
--- Consolidates migrations 001–015.
+-- Consolidates migrations 001–030.
 
 CREATE EXTENSION IF NOT EXISTS pgcrypto;
 
@@ -83,6 +83,8 @@ CREATE TABLE IF NOT EXISTS appointments.doctors (
     name           TEXT        NOT NULL,
     specialization TEXT        NOT NULL,
     slot_capacity  INT         NOT NULL DEFAULT 1,
+    slot_minutes   INT         NOT NULL DEFAULT 15 CHECK (slot_minutes BETWEEN 5 AND 240),
+    default_duration_minutes INT NOT NULL DEFAULT 15 CHECK (default_duration_minutes > 0),
     created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
@@ -91,17 +93,37 @@ CREATE TABLE IF NOT EXISTS appointments.appointments (
     patient_id     TEXT        NOT NULL,
     doctor_id      TEXT        REFERENCES appointments.doctors(id),
     start_time     TIMESTAMPTZ,
+    end_time       TIMESTAMPTZ,
     session        TEXT        CHECK (session IN ('morning', 'afternoon')),
+    appointment_date DATE,                   -- clinic day of a session booking; NULL for doctor bookings
     estimated_time TIMESTAMPTZ,
     queue_position INT,
     notes          TEXT,
     status         TEXT        NOT NULL DEFAULT 'scheduled',
+    cancellation_reason TEXT,                -- set on cancel; see cancellation_reason_valid
+    cancellation_note   TEXT,
+    cancelled_by        TEXT,                -- actor ID of whoever cancelled
+    cancelled_at        TIMESTAMPTZ,
+    checked_in_at       TIMESTAMPTZ,
+    checked_in_kiosk    BOOLEAN     NOT NULL DEFAULT FALSE,
+    checked_in_late     BOOLEAN,             -- kiosk check-ins of doctor bookings only
     created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT appointments_status_valid CHECK (
+        status IN ('scheduled', 'checked_in', 'in_progress', 'completed', 'cancelled', 'no_show')
+    ),
+    CONSTRAINT cancellation_reason_valid CHECK (
+        cancellation_reason IN ('patient_request', 'clinic_closure', 'doctor_unavailable', 'system_rollback', 'duplicate')
+    ),
     CONSTRAINT booking_type_valid CHECK (
-        (session IS NOT NULL AND start_time IS NULL AND doctor_id IS NULL)
+        (session IS NOT NULL AND appointment_date IS NOT NULL AND start_time IS NULL AND doctor_id IS NULL)
         OR
-        (session IS NULL AND start_time IS NOT NULL AND doctor_id IS NOT NULL)
+        (session IS NULL AND appointment_date IS NULL AND start_time IS NOT NULL AND doctor_id IS NOT NULL)
+    ),
+    CONSTRAINT appointment_interval_valid CHECK (
+        (start_time IS NULL AND end_time IS NULL)
+        OR
+        (start_time IS NOT NULL AND end_time > start_time)
     )
 );
 
@@ -112,6 +134,165 @@ CREATE INDEX IF NOT EXISTS idx_appointments_doctor_start
 CREATE INDEX IF NOT EXISTS idx_appointments_patient
     ON appointments.appointments(patient_id);
 
+CREATE INDEX IF NOT EXISTS idx_appointments_doctor_interval
+    ON appointments.appointments(doctor_id, start_time, end_time)
+    WHERE status NOT IN ('cancelled', 'no_show', 'completed');
+
+CREATE INDEX IF NOT EXISTS idx_appointments_session_date
+    ON appointments.appointments(session, appointment_date)
+    WHERE session IS NOT NULL AND status NOT IN ('cancelled', 'no_show', 'completed');
+
+-- Keyset pagination for GET /appointments (sort=created_at).
+CREATE INDEX IF NOT EXISTS idx_appointments_created_id
+    ON appointments.appointments(created_at, id);
+
+-- Reporting on cancellation causes.
+CREATE INDEX IF NOT EXISTS idx_appointments_cancellation_reason
+    ON appointments.appointments(cancellation_reason, cancelled_at)
+    WHERE status = 'cancelled';
+
+-- Per-date session capacity; dates without a row use SESSION_CAPACITY_DEFAULT.
+CREATE TABLE IF NOT EXISTS appointments.session_capacity (
+    session_date DATE        NOT NULL,
+    session      TEXT        NOT NULL CHECK (session IN ('morning', 'afternoon')),
+    capacity     INT         NOT NULL CHECK (capacity >= 0),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (session_date, session)
+);
+
+-- Weekly working windows in clinic time; doctors with no rows use the default session hours Mon–Sat.
+CREATE TABLE IF NOT EXISTS appointments.doctor_working_hours (
+    doctor_id  TEXT     NOT NULL REFERENCES appointments.doctors(id) ON DELETE CASCADE,
+    weekday    SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),  -- 0 = Sunday
+    start_time TIME     NOT NULL,
+    end_time   TIME     NOT NULL,
+    PRIMARY KEY (doctor_id, weekday, start_time),
+    CONSTRAINT working_hours_valid CHECK (end_time > start_time)
+);
+
+CREATE TABLE IF NOT EXISTS appointments.clinic_closures (
+    closure_date DATE        PRIMARY KEY,
+    reason       TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Waitlist for full slots/sessions; entries are promoted into appointments as capacity frees up.
+CREATE TABLE IF NOT EXISTS appointments.waitlist_entries (
+    id               UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    patient_id       TEXT        NOT NULL,
+    doctor_id        TEXT        REFERENCES appointments.doctors(id),
+    start_time       TIMESTAMPTZ,
+    duration_minutes INT,
+    session          TEXT        CHECK (session IN ('morning', 'afternoon')),
+    session_date     DATE,
+    notes            TEXT,
+    status           TEXT        NOT NULL DEFAULT 'waiting'
+        CHECK (status IN ('waiting', 'promoted', 'cancelled')),
+    appointment_id   UUID        REFERENCES appointments.appointments(id),
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    promoted_at      TIMESTAMPTZ,
+    CONSTRAINT waitlist_type_valid CHECK (
+        (session IS NOT NULL AND session_date IS NOT NULL AND start_time IS NULL AND doctor_id IS NULL)
+        OR
+        (session IS NULL AND session_date IS NULL AND start_time IS NOT NULL AND doctor_id IS NOT NULL
+            AND duration_minutes > 0)
+    )
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_waitlist_doctor_slot
+    ON appointments.waitlist_entries(patient_id, doctor_id, start_time)
+    WHERE status = 'waiting' AND doctor_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_waitlist_session
+    ON appointments.waitlist_entries(patient_id, session, session_date)
+    WHERE status = 'waiting' AND session IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_waitlist_doctor_waiting
+    ON appointments.waitlist_entries(doctor_id, start_time, created_at)
+    WHERE status = 'waiting';
+
+-- Last applied queue snapshot version per queue ('doctor:<id>:<date>' or 'session:<session>:<date>').
+CREATE TABLE IF NOT EXISTS appointments.queue_snapshot_versions (
+    queue_key  TEXT        PRIMARY KEY,
+    version    BIGINT      NOT NULL CHECK (version > 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Transactional outbox; the appointment-service relay publishes pending rows to clinic.events.
+CREATE TABLE IF NOT EXISTS appointments.outbox (
+    seq          BIGSERIAL   PRIMARY KEY,
+    id           UUID        NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+    aggregate_id UUID        NOT NULL,  -- appointment the event is about
+    routing_key  TEXT        NOT NULL,
+    payload      JSONB       NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ,
+    attempts     INT         NOT NULL DEFAULT 0,
+    last_error   TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending
+    ON appointments.outbox(seq)
+    WHERE published_at IS NULL;
+
+-- Consumed clinic.events IDs, so redelivered queue/consultation events are applied once.
+CREATE TABLE IF NOT EXISTS appointments.processed_events (
+    event_id     TEXT        PRIMARY KEY,  -- AMQP message-id, or sha256 of routing key + body
+    routing_key  TEXT        NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_events_processed_at
+    ON appointments.processed_events (processed_at);
+
+-- Idempotency-Key records for POST /appointments, replayed until expires_at.
+CREATE TABLE IF NOT EXISTS appointments.idempotency_keys (
+    key          TEXT        NOT NULL,
+    actor_id     TEXT        NOT NULL,  -- JWT sub of the caller
+    request_hash TEXT        NOT NULL,  -- sha256 of the decoded request body
+    status_code  INT,
+    response     JSONB,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at   TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (key, actor_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires
+    ON appointments.idempotency_keys(expires_at);
+
+-- Append-only audit trail, written in the same transaction as each appointment mutation.
+CREATE TABLE IF NOT EXISTS appointments.appointment_events (
+    id                BIGSERIAL   PRIMARY KEY,
+    appointment_id    UUID        REFERENCES appointments.appointments(id),
+    waitlist_entry_id UUID        REFERENCES appointments.waitlist_entries(id),  -- waitlist joins, leaves and promotions
+    event_type        TEXT        NOT NULL
+        CHECK (event_type IN ('created', 'status_changed', 'cancelled', 'rescheduled',
+                              'waitlist_joined', 'waitlist_left', 'waitlist_promoted')),
+    actor_id          TEXT,
+    old_value         JSONB,
+    new_value         JSONB,
+    reason            TEXT,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT appointment_events_subject_check CHECK (appointment_id IS NOT NULL OR waitlist_entry_id IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_appointment_events_appointment
+    ON appointments.appointment_events(appointment_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_appointment_events_waitlist_entry
+    ON appointments.appointment_events(waitlist_entry_id, created_at)
+    WHERE waitlist_entry_id IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION appointments.reject_event_mutation()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'appointment_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_appointment_events_append_only ON appointments.appointment_events;
+CREATE TRIGGER trg_appointment_events_append_only
+    BEFORE UPDATE OR DELETE ON appointments.appointment_events
+    FOR EACH ROW EXECUTE FUNCTION appointments.reject_event_mutation();
+
 -- ─── Queue ───────────────────────────────────────────────────────────────────
 CREATE SCHEMA IF NOT EXISTS queue;
 
@@ -23,7 +23,8 @@ fi
 for var in AWS_ACCOUNT_ID AWS_REGION DB_URL MQ_URL REDIS_URL BETTER_AUTH_SECRET \
            BETTER_AUTH_URL FRONTEND_BASE_URL AWS_ACCESS_KEY_ID AWS_SECRET_ACCESS_KEY \
            S3_BUCKET GOOGLE_MAPS_API_KEY TWILIO_ACCOUNT_SID TWILIO_AUTH_TOKEN \
-           STRIPE_API_KEY STRIPE_WEBHOOK_SIGNING_SECRET COGNITO_JWKS_URL; do
+           STRIPE_API_KEY STRIPE_WEBHOOK_SIGNING_SECRET COGNITO_JWKS_URL \
+           COGNITO_CLIENT_ID CHECK_IN_SECRET; do
     eval val=\$$var
     if [ -z "$val" ]; then
         echo "ERROR: $var is not set in .env.aws"
@@ -105,8 +106,11 @@ register appointment-service <<EOF
     "portMappings": [{"containerPort": 3001}],
     "environment": [
       {"name": "DATABASE_URL", "value": "$DB_URL"},
+      {"name": "RABBITMQ_URL", "value": "$MQ_URL"},
       {"name": "PORT", "value": "3001"},
-      {"name": "JWKS_URL", "value": "$COGNITO_JWKS_URL"}
+      {"name": "JWKS_URL", "value": "$COGNITO_JWKS_URL"},
+      {"name": "COGNITO_CLIENT_ID", "value": "$COGNITO_CLIENT_ID"},
+      {"name": "CHECK_IN_SECRET", "value": "$CHECK_IN_SECRET"}
     ],
     "logConfiguration": $(log appointment-service)
   }]
@@ -329,7 +333,6 @@ register composite-appointment <<EOF
     "environment": [
       {"name": "JWKS_URL", "value": "$COGNITO_JWKS_URL"},
       {"name": "APPOINTMENT_SERVICE_URL", "value": "http://appointment-service.$NS:3001"},
-      {"name": "RABBITMQ_URL", "value": "$MQ_URL"},
       {"name": "PORT", "value": "8000"}
     ],
     "logConfiguration": $(log composite-appointment)
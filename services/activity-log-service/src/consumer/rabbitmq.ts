@@ -6,8 +6,8 @@
  * the activity_log.logs table for auditing and patient history.
  *
  * Routing keys consumed:
- *   - appointment.booked      (from composite-appointment)
- *   - appointment.cancelled   (from composite-appointment)
+ *   - appointment.booked      (from appointment-service outbox)
+ *   - appointment.cancelled   (from appointment-service outbox)
  *   - checkin.completed       (from check-in orchestrator — future)
  *   - queue.called            (from queue coordinator — future)
  *   - queue.completed         (from queue coordinator — future)
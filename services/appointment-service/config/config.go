@@ -0,0 +1,224 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // the runtime image has no zoneinfo
+)
+
+// ClinicLocation is the timezone clinic days, sessions and working hours are evaluated in.
+// Set CLINIC_TIMEZONE to an IANA name; defaults to Asia/Singapore.
+var ClinicLocation = sync.OnceValue(func() *time.Location {
+	name := os.Getenv("CLINIC_TIMEZONE")
+	if name == "" {
+		name = "Asia/Singapore"
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Fatalf("invalid CLINIC_TIMEZONE %q: %v", name, err)
+	}
+	return loc
+})
+
+// DefaultSessionCapacity is the number of bookings a morning or afternoon session takes
+// when no per-date override exists in session_capacity.
+var DefaultSessionCapacity = sync.OnceValue(func() int {
+	return intEnv("SESSION_CAPACITY_DEFAULT", 40)
+})
+
+// JWKSURL is the endpoint the token signing keys are fetched from.
+func JWKSURL() string {
+	if url := os.Getenv("JWKS_URL"); url != "" {
+		return url
+	}
+	return "http://auth-service:3000/api/auth/jwks"
+}
+
+// CognitoClientID is the user pool app client whose ID tokens are accepted when JWKS_URL
+// points at Cognito and AUTH_ISSUERS is unset.
+func CognitoClientID() string {
+	return os.Getenv("COGNITO_CLIENT_ID")
+}
+
+// IsDevelopment reports whether APP_ENV marks this as a local development deployment.
+// Anything else, including an unset APP_ENV, is treated as production.
+func IsDevelopment() bool {
+	switch strings.ToLower(os.Getenv("APP_ENV")) {
+	case "development", "dev", "local":
+		return true
+	}
+	return false
+}
+
+// LocalJWTSecret returns JWT_SECRET when the service should validate HS256 tokens with it:
+// only when neither JWKS_URL nor AUTH_ISSUERS is set. Enabling it outside development is
+// fatal, so a stray secret can never downgrade production to shared-secret tokens.
+func LocalJWTSecret() string {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" || os.Getenv("JWKS_URL") != "" || os.Getenv("AUTH_ISSUERS") != "" {
+		return ""
+	}
+	if !IsDevelopment() {
+		log.Fatalf("JWT_SECRET is set without JWKS_URL or AUTH_ISSUERS, but HS256 local mode requires APP_ENV=development")
+	}
+	return secret
+}
+
+// AuthIssuers is the raw AUTH_ISSUERS JSON describing the trusted token issuers; see
+// middleware.LoadIssuers. Empty means a single issuer derived from JWKS_URL.
+func AuthIssuers() string {
+	return os.Getenv("AUTH_ISSUERS")
+}
+
+// JWKSRefreshInterval is how often the signing keys are refetched in the background.
+var JWKSRefreshInterval = sync.OnceValue(func() time.Duration {
+	return durationEnv("JWKS_REFRESH_INTERVAL", 15*time.Minute)
+})
+
+// JWKSMinRefreshGap is the minimum time between refetches triggered by tokens with an
+// unknown kid.
+var JWKSMinRefreshGap = sync.OnceValue(func() time.Duration {
+	return durationEnv("JWKS_MIN_REFRESH_GAP", 30*time.Second)
+})
+
+// RabbitMQURL is the broker appointment events are published to. It is required outside
+// development; there an empty value disables the outbox relay and events accumulate in the
+// outbox until it is configured.
+func RabbitMQURL() string {
+	return os.Getenv("RABBITMQ_URL")
+}
+
+// OutboxBatchSize is the most outbox rows the relay publishes per round.
+var OutboxBatchSize = sync.OnceValue(func() int {
+	return intEnv("OUTBOX_BATCH_SIZE", 100)
+})
+
+// OutboxPollInterval is how often the relay checks an empty outbox.
+var OutboxPollInterval = sync.OnceValue(func() time.Duration {
+	return durationEnv("OUTBOX_POLL_INTERVAL", time.Second)
+})
+
+// EventConsumerEnabled turns on applying queue.checked_in, queue.removed and
+// consultation.completed events from RABBITMQ_URL as status transitions. Off by default so
+// callers that already PATCH the status are not doubled up during rollout.
+func EventConsumerEnabled() bool {
+	return boolEnv("EVENT_CONSUMER_ENABLED", false)
+}
+
+// EventMaxAttempts is how many times the event consumer tries a message that keeps failing
+// with a transient error before dead-lettering it.
+var EventMaxAttempts = sync.OnceValue(func() int {
+	n := intEnv("EVENT_MAX_ATTEMPTS", 5)
+	if n < 1 {
+		log.Fatalf("EVENT_MAX_ATTEMPTS must be at least 1, got %d", n)
+	}
+	return n
+})
+
+// ProcessedEventRetention is how long consumed event IDs are remembered for deduplication.
+var ProcessedEventRetention = sync.OnceValue(func() time.Duration {
+	return durationEnv("PROCESSED_EVENT_RETENTION", 7*24*time.Hour)
+})
+
+// OutboxRetention is how long published outbox rows are kept before being deleted.
+var OutboxRetention = sync.OnceValue(func() time.Duration {
+	return durationEnv("OUTBOX_RETENTION", 7*24*time.Hour)
+})
+
+// IdempotencyKeyTTL is how long an Idempotency-Key on POST /appointments replays its
+// original response. After that the key may be reused for a new booking.
+var IdempotencyKeyTTL = sync.OnceValue(func() time.Duration {
+	return durationEnv("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+})
+
+// NoShowGrace is how long after an appointment's start (or a session's end) a booking
+// that was never checked in is marked no_show.
+var NoShowGrace = sync.OnceValue(func() time.Duration {
+	return durationEnv("NO_SHOW_GRACE", 30*time.Minute)
+})
+
+// NoShowSweepInterval is how often the no-show sweeper looks for overdue bookings.
+var NoShowSweepInterval = sync.OnceValue(func() time.Duration {
+	return durationEnv("NO_SHOW_SWEEP_INTERVAL", time.Minute)
+})
+
+// PatientPreventOverlap rejects a booking that overlaps another active booking of the same
+// patient. Session bookings occupy their whole session window.
+var PatientPreventOverlap = sync.OnceValue(func() bool {
+	return boolEnv("PATIENT_PREVENT_OVERLAP", true)
+})
+
+// PatientOneSessionPerDay limits a patient to one session booking per clinic day.
+var PatientOneSessionPerDay = sync.OnceValue(func() bool {
+	return boolEnv("PATIENT_ONE_SESSION_PER_DAY", true)
+})
+
+// PatientMaxActiveBookings caps how many active bookings that haven't ended yet a patient
+// may hold. 0 means no limit.
+var PatientMaxActiveBookings = sync.OnceValue(func() int {
+	return intEnv("PATIENT_MAX_ACTIVE_BOOKINGS", 3)
+})
+
+// CheckInSecret is the HMAC key that signs check-in codes. Kiosks only verify codes
+// through this service, so it never leaves it; without it check-in codes are disabled.
+func CheckInSecret() string {
+	return os.Getenv("CHECK_IN_SECRET")
+}
+
+// CheckInCodeTTL is how long a check-in code stays valid after it is issued.
+var CheckInCodeTTL = sync.OnceValue(func() time.Duration {
+	return durationEnv("CHECK_IN_CODE_TTL", 5*time.Minute)
+})
+
+// CheckInOpensBefore is how long before an appointment's start (or its session's start)
+// the patient may check in.
+var CheckInOpensBefore = sync.OnceValue(func() time.Duration {
+	return durationEnv("CHECK_IN_OPENS_BEFORE", time.Hour)
+})
+
+// CheckInLateAfter is how long after the start a check-in is still on time; later ones are
+// flagged late. Check-in closes when the no-show sweeper would take the booking.
+var CheckInLateAfter = sync.OnceValue(func() time.Duration {
+	return durationEnv("CHECK_IN_LATE_AFTER", 10*time.Minute)
+})
+
+func intEnv(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("invalid %s %q: %v", key, v, err)
+	}
+	return n
+}
+
+func boolEnv(key string, fallback bool) bool {
+	switch strings.ToLower(os.Getenv(key)) {
+	case "":
+		return fallback
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	log.Fatalf("invalid %s %q: expected true or false", key, os.Getenv(key))
+	return false
+}
+
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Fatalf("invalid %s %q: expected a positive duration such as 30s or 15m", key, v)
+	}
+	return d
+}
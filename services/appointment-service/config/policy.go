@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// BookingPolicy limits when a role may book, move and cancel appointments.
+type BookingPolicy struct {
+	MinLeadTime  time.Duration // earliest a doctor slot may start, measured from now
+	MaxHorizon   time.Duration // latest a booking may start, measured from now
+	CancelCutoff time.Duration // no cancelling or moving a booking starting sooner than this
+	UndoWindow   time.Duration // CancelCutoff does not apply to bookings made less than this ago
+}
+
+// defaultBookingPolicies apply to roles and fields BOOKING_POLICIES does not override.
+// Roles without an entry get the patient policy.
+var defaultBookingPolicies = map[string]BookingPolicy{
+	"patient": {MinLeadTime: 15 * time.Minute, MaxHorizon: 60 * 24 * time.Hour, CancelCutoff: 2 * time.Hour, UndoWindow: 5 * time.Minute},
+	"doctor":  {MinLeadTime: 15 * time.Minute, MaxHorizon: 60 * 24 * time.Hour, CancelCutoff: 2 * time.Hour, UndoWindow: 5 * time.Minute},
+	"staff":   {MaxHorizon: 365 * 24 * time.Hour},
+	"admin":   {MaxHorizon: 365 * 24 * time.Hour},
+	"service": {MaxHorizon: 365 * 24 * time.Hour},
+}
+
+// BookingPolicies is the per-role booking policy, from the defaults above overlaid with
+// BOOKING_POLICIES, e.g. {"patient":{"min_lead_time":"1h","cancel_cutoff":"24h"}}.
+// Durations use Go syntax ("90m", "720h"); "0" disables a limit.
+var BookingPolicies = sync.OnceValue(func() map[string]BookingPolicy {
+	policies := make(map[string]BookingPolicy, len(defaultBookingPolicies))
+	for role, p := range defaultBookingPolicies {
+		policies[role] = p
+	}
+	raw := os.Getenv("BOOKING_POLICIES")
+	if raw == "" {
+		return policies
+	}
+
+	var overrides map[string]struct {
+		MinLeadTime  *string `json:"min_lead_time"`
+		MaxHorizon   *string `json:"max_horizon"`
+		CancelCutoff *string `json:"cancel_cutoff"`
+		UndoWindow   *string `json:"undo_window"`
+	}
+	if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+		log.Fatalf("invalid BOOKING_POLICIES: %v", err)
+	}
+	for role, o := range overrides {
+		p, ok := policies[role]
+		if !ok {
+			p = policies["patient"]
+		}
+		for _, f := range []struct {
+			name string
+			raw  *string
+			dst  *time.Duration
+		}{
+			{"min_lead_time", o.MinLeadTime, &p.MinLeadTime},
+			{"max_horizon", o.MaxHorizon, &p.MaxHorizon},
+			{"cancel_cutoff", o.CancelCutoff, &p.CancelCutoff},
+			{"undo_window", o.UndoWindow, &p.UndoWindow},
+		} {
+			if f.raw == nil {
+				continue
+			}
+			d, err := time.ParseDuration(*f.raw)
+			if err != nil || d < 0 {
+				log.Fatalf("invalid BOOKING_POLICIES %s.%s %q: expected a duration such as 2h", role, f.name, *f.raw)
+			}
+			*f.dst = d
+		}
+		policies[role] = p
+	}
+	return policies
+})
+
+// BookingPolicyFor returns the booking policy of role.
+func BookingPolicyFor(role string) BookingPolicy {
+	policies := BookingPolicies()
+	if p, ok := policies[role]; ok {
+		return p
+	}
+	return policies["patient"]
+}
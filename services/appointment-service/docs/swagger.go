@@ -8,7 +8,7 @@ const SwaggerJSON = `{
   "info": {
     "title": "Appointment Service",
     "version": "1.0.0",
-    "description": "Manages appointment booking, status updates, and cancellations"
+    "description": "Manages appointment booking, status updates, and cancellations. Every booking, cancellation, reschedule and check-in/completion/no-show is published to the clinic.events exchange (appointment.booked, .cancelled, .rescheduled, .checked_in, .completed, .no_show) via a transactional outbox; the AMQP message-id is a stable event ID for deduplication. Access depends on the JWT role claim (role or custom:role): patients see and manage only their own bookings, doctors bookings with them (and see unassigned session bookings, which a list without doctor_id includes), staff and admins everything. Machine identities (client-credentials tokens, or tokens from an internal signer) have no role and are authorised by scope: appointments:read, appointments:write, appointments:write-status and appointments:write-queue."
   },
   "servers": [{ "url": "/" }],
   "components": {
@@ -19,7 +19,40 @@ const SwaggerJSON = `{
         "bearerFormat": "JWT"
       }
     },
+    "parameters": {
+      "IfMatch": { "in": "header", "name": "If-Match", "schema": { "type": "string" }, "description": "ETag from an earlier read; the change is refused with 412 if the appointment has been modified since. Queue position and ETA refreshes don't count as modifications." },
+      "IfNoneMatch": { "in": "header", "name": "If-None-Match", "schema": { "type": "string" }, "description": "ETag from an earlier response; 304 is returned if nothing changed" }
+    },
     "schemas": {
+      "BookingConflict": {
+        "type": "object",
+        "properties": {
+          "error": { "type": "string" },
+          "code":  { "type": "string", "enum": ["patient_overlap","patient_session_per_day","patient_booking_limit"], "description": "Set when a patient-level rule rejected the booking: it overlaps another active booking of the patient, the patient already has a session that day, or already holds PATIENT_MAX_ACTIVE_BOOKINGS upcoming bookings" },
+          "conflicting_appointment_id": { "type": "string", "format": "uuid" }
+        }
+      },
+      "PolicyError": {
+        "type": "object",
+        "description": "A booking policy of the caller's role (BOOKING_POLICIES) or the check-in window refused the request. Exactly one of earliest_start, latest_start, cutoff_at, opens_at or closed_at is set, matching code.",
+        "properties": {
+          "error":          { "type": "string", "description": "Message suitable for showing to the user" },
+          "code":           { "type": "string", "enum": ["booking_lead_time","booking_horizon","cancellation_cutoff","check_in_not_open","check_in_closed"] },
+          "limit":          { "type": "string", "description": "The policy's duration, e.g. 2h0m0s" },
+          "earliest_start": { "type": "string", "format": "date-time" },
+          "latest_start":   { "type": "string", "format": "date-time" },
+          "cutoff_at":      { "type": "string", "format": "date-time", "description": "Last moment the appointment could be cancelled or moved" },
+          "opens_at":       { "type": "string", "format": "date-time" },
+          "closed_at":      { "type": "string", "format": "date-time" }
+        }
+      },
+      "AppointmentPage": {
+        "type": "object",
+        "properties": {
+          "items":       { "type": "array", "items": { "$ref": "#/components/schemas/Appointment" } },
+          "next_cursor": { "type": "string", "nullable": true }
+        }
+      },
       "Appointment": {
         "type": "object",
         "properties": {
@@ -27,13 +60,128 @@ const SwaggerJSON = `{
           "patient_id":     { "type": "string" },
           "doctor_id":      { "type": "string", "nullable": true },
           "start_time":     { "type": "string", "format": "date-time", "nullable": true },
+          "end_time":       { "type": "string", "format": "date-time", "nullable": true },
+          "duration_minutes": { "type": "integer", "nullable": true },
           "session":        { "type": "string", "enum": ["morning","afternoon"], "nullable": true },
+          "appointment_date": { "type": "string", "format": "date", "description": "Clinic day; stored for session bookings, derived from start_time for doctor bookings" },
           "estimated_time": { "type": "string", "format": "date-time", "nullable": true },
           "queue_position": { "type": "integer", "nullable": true },
           "notes":          { "type": "string", "nullable": true },
           "status":         { "type": "string", "enum": ["scheduled","checked_in","in_progress","completed","cancelled","no_show"] },
           "created_at":     { "type": "string", "format": "date-time" },
-          "updated_at":     { "type": "string", "format": "date-time" }
+          "updated_at":     { "type": "string", "format": "date-time" },
+          "cancellation_reason": { "type": "string", "enum": ["patient_request","clinic_closure","doctor_unavailable","system_rollback","duplicate"], "nullable": true, "description": "Set on cancelled appointments when the canceller gave a reason_code" },
+          "cancellation_note":   { "type": "string", "nullable": true, "description": "Free-text reason given with the cancellation" },
+          "cancelled_by":        { "type": "string", "nullable": true, "description": "Actor ID of whoever cancelled" },
+          "cancelled_at":        { "type": "string", "format": "date-time", "nullable": true },
+          "checked_in_at":       { "type": "string", "format": "date-time", "nullable": true },
+          "checked_in_kiosk":    { "type": "boolean", "description": "Whether the patient checked in at a front-desk kiosk" },
+          "checked_in_late":     { "type": "boolean", "nullable": true, "description": "Whether the patient arrived more than CHECK_IN_LATE_AFTER after start_time; set by kiosk check-ins of doctor bookings only, null for sessions" }
+        }
+      },
+      "CheckInCode": {
+        "type": "object",
+        "properties": {
+          "appointment_id": { "type": "string", "format": "uuid" },
+          "code":           { "type": "string", "description": "Signed code to show as a QR code at the front-desk kiosk" },
+          "expires_at":     { "type": "string", "format": "date-time" }
+        }
+      },
+      "AppointmentEvent": {
+        "type": "object",
+        "properties": {
+          "id":             { "type": "integer" },
+          "appointment_id": { "type": "string", "format": "uuid", "nullable": true, "description": "Null for waitlist joins and leaves" },
+          "waitlist_entry_id": { "type": "string", "format": "uuid", "description": "Set on waitlist events only" },
+          "event_type":     { "type": "string", "enum": ["created","status_changed","cancelled","rescheduled","waitlist_joined","waitlist_left","waitlist_promoted"] },
+          "actor_id":       { "type": "string", "nullable": true },
+          "old_value":      { "type": "object", "nullable": true },
+          "new_value":      { "type": "object", "nullable": true },
+          "reason":         { "type": "string", "nullable": true },
+          "created_at":     { "type": "string", "format": "date-time" }
+        }
+      },
+      "WaitlistEntry": {
+        "type": "object",
+        "properties": {
+          "id":               { "type": "string", "format": "uuid" },
+          "patient_id":       { "type": "string" },
+          "doctor_id":        { "type": "string", "nullable": true },
+          "start_time":       { "type": "string", "format": "date-time", "nullable": true },
+          "duration_minutes": { "type": "integer", "nullable": true },
+          "session":          { "type": "string", "enum": ["morning","afternoon"], "nullable": true },
+          "appointment_date": { "type": "string", "format": "date", "nullable": true },
+          "notes":            { "type": "string", "nullable": true },
+          "status":           { "type": "string", "enum": ["waiting","promoted","cancelled"] },
+          "appointment_id":   { "type": "string", "format": "uuid", "nullable": true },
+          "created_at":       { "type": "string", "format": "date-time" },
+          "promoted_at":      { "type": "string", "format": "date-time", "nullable": true }
+        }
+      },
+      "Doctor": {
+        "type": "object",
+        "properties": {
+          "id":                       { "type": "string" },
+          "name":                     { "type": "string" },
+          "specialization":           { "type": "string" },
+          "slot_capacity":            { "type": "integer" },
+          "slot_minutes":             { "type": "integer" },
+          "default_duration_minutes": { "type": "integer" }
+        }
+      },
+      "WorkingHours": {
+        "type": "object",
+        "required": ["weekday","start_time","end_time"],
+        "properties": {
+          "weekday":    { "type": "integer", "minimum": 0, "maximum": 6, "description": "0 = Sunday" },
+          "start_time": { "type": "string", "example": "09:00" },
+          "end_time":   { "type": "string", "example": "12:00" }
+        }
+      },
+      "ClinicClosure": {
+        "type": "object",
+        "properties": {
+          "date":   { "type": "string", "format": "date" },
+          "reason": { "type": "string", "nullable": true }
+        }
+      },
+      "DoctorAvailability": {
+        "type": "object",
+        "properties": {
+          "doctor_id":     { "type": "string" },
+          "date":          { "type": "string", "format": "date" },
+          "closed_reason": { "type": "string", "description": "Present when the clinic is closed that day" },
+          "slots": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "start_time": { "type": "string", "format": "date-time" },
+                "capacity":   { "type": "integer" },
+                "booked":     { "type": "integer" },
+                "remaining":  { "type": "integer" }
+              }
+            }
+          }
+        }
+      },
+      "SessionAvailability": {
+        "type": "object",
+        "properties": {
+          "session":       { "type": "string", "enum": ["morning","afternoon"] },
+          "date":          { "type": "string", "format": "date" },
+          "closed_reason": { "type": "string", "description": "Present when the clinic is closed that day" },
+          "capacity":      { "type": "integer" },
+          "booked":    { "type": "integer" },
+          "remaining": { "type": "integer" }
+        }
+      },
+      "TransitionError": {
+        "type": "object",
+        "properties": {
+          "error":          { "type": "string" },
+          "current_status": { "type": "string" },
+          "allowed_next":   { "type": "array", "items": { "type": "string" } }
         }
       }
     }
@@ -44,22 +192,43 @@ const SwaggerJSON = `{
       "get": {
         "summary": "List appointments",
         "tags": ["Appointments"],
+        "description": "Without limit or cursor, returns every matching appointment as an array. Paging is opt-in: with limit or cursor the response is an AppointmentPage holding one page; pass next_cursor back as cursor (with the same sort and order) for the following page, it is null on the last page. Dates are clinic days: the start_time date for doctor bookings and appointment_date for session bookings.",
         "parameters": [
           { "in": "query", "name": "patient_id", "schema": { "type": "string" }, "description": "Filter by patient ID" },
           { "in": "query", "name": "doctor_id",  "schema": { "type": "string" }, "description": "Filter by doctor ID" },
-          { "in": "query", "name": "date",        "schema": { "type": "string", "format": "date" }, "description": "Filter by date (YYYY-MM-DD)" }
+          { "in": "query", "name": "status",     "schema": { "type": "array", "items": { "type": "string", "enum": ["scheduled","checked_in","in_progress","completed","cancelled","no_show"] } }, "style": "form", "explode": true, "description": "Repeat or comma-separate to match any of several statuses" },
+          { "in": "query", "name": "session",    "schema": { "type": "string", "enum": ["morning","afternoon"] } },
+          { "in": "query", "name": "cancellation_reason", "schema": { "type": "array", "items": { "type": "string", "enum": ["patient_request","clinic_closure","doctor_unavailable","system_rollback","duplicate"] } }, "style": "form", "explode": true, "description": "Repeat or comma-separate to match any of several reasons" },
+          { "in": "query", "name": "cancelled_by", "schema": { "type": "string" }, "description": "Actor ID of whoever cancelled" },
+          { "in": "query", "name": "date",       "schema": { "type": "string", "format": "date" }, "description": "Single clinic day (YYYY-MM-DD); shorthand for from=to=date" },
+          { "in": "query", "name": "from",       "schema": { "type": "string", "format": "date" }, "description": "First clinic day, inclusive" },
+          { "in": "query", "name": "to",         "schema": { "type": "string", "format": "date" }, "description": "Last clinic day, inclusive" },
+          { "in": "query", "name": "sort",       "schema": { "type": "string", "enum": ["created_at","start_time"], "default": "created_at" }, "description": "start_time orders session bookings by the start of their session" },
+          { "in": "query", "name": "order",      "schema": { "type": "string", "enum": ["asc","desc"], "default": "asc" } },
+          { "in": "query", "name": "limit",      "schema": { "type": "integer", "minimum": 1, "maximum": 200 }, "description": "Page size; 50 when only cursor is given. Either parameter switches the response to an AppointmentPage" },
+          { "in": "query", "name": "cursor",     "schema": { "type": "string" }, "description": "Opaque next_cursor from the previous page" },
+          { "$ref": "#/components/parameters/IfNoneMatch" }
         ],
         "responses": {
+          "304": { "description": "Unchanged since the If-None-Match ETag" },
+          "400": { "description": "Invalid filter, sort, limit or cursor" },
+          "403": { "description": "Patient filtered by another patient_id, or doctor filtered by another doctor_id" },
           "200": {
-            "description": "Array of appointments",
-            "content": { "application/json": { "schema": { "type": "array", "items": { "$ref": "#/components/schemas/Appointment" } } } }
+            "description": "Array of appointments, or one AppointmentPage when limit or cursor is given",
+            "content": { "application/json": { "schema": { "oneOf": [
+              { "type": "array", "items": { "$ref": "#/components/schemas/Appointment" } },
+              { "$ref": "#/components/schemas/AppointmentPage" }
+            ] } } }
           }
         }
       },
       "post": {
         "summary": "Create an appointment",
         "tags": ["Appointments"],
-        "description": "Provide either 'session' (morning/afternoon) for generic booking, or 'start_time' + 'doctor_id' for a specific slot.",
+        "description": "Provide either 'session' (morning/afternoon) + 'appointment_date' for generic booking, or 'start_time' + 'doctor_id' for a specific slot. appointment_date must be today or a later clinic day, and today's session must not have ended. Send an Idempotency-Key to make retries safe: repeating the request with the same key and body returns the original 201 (with Idempotent-Replayed: true) instead of booking again.",
+        "parameters": [
+          { "in": "header", "name": "Idempotency-Key", "schema": { "type": "string", "maxLength": 255 }, "description": "Client-chosen key, scoped to the caller and remembered for IDEMPOTENCY_KEY_TTL (default 24h)" }
+        ],
         "requestBody": {
           "required": true,
           "content": {
@@ -71,7 +240,9 @@ const SwaggerJSON = `{
                   "patient_id": { "type": "string" },
                   "doctor_id":  { "type": "string", "nullable": true },
                   "start_time": { "type": "string", "format": "date-time", "nullable": true },
+                  "duration_minutes": { "type": "integer", "nullable": true, "description": "Multiple of the doctor's slot_minutes; defaults to default_duration_minutes" },
                   "session":    { "type": "string", "enum": ["morning","afternoon"], "nullable": true },
+                  "appointment_date": { "type": "string", "format": "date", "nullable": true, "description": "Required with session" },
                   "notes":      { "type": "string", "nullable": true }
                 }
               }
@@ -79,9 +250,284 @@ const SwaggerJSON = `{
           }
         },
         "responses": {
+          "403": { "description": "Patients can only book for themselves" },
           "201": { "description": "Appointment created", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Appointment" } } } },
+          "400": { "description": "Validation error, clinic closed, or outside the doctor's working hours" },
+          "409": { "description": "Slot full for this doctor, session full on that date, or a patient rule was broken", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/BookingConflict" } } } },
+          "422": { "description": "Idempotency-Key was already used with a different request body, or start_time is sooner than the role's minimum lead time or beyond its booking horizon", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/PolicyError" } } } }
+        }
+      }
+    },
+    "/appointments/availability": {
+      "get": {
+        "summary": "Remaining capacity for a doctor's slots or a session",
+        "tags": ["Capacity"],
+        "description": "With doctor_id, returns every slot (at the doctor's slot_minutes) in the doctor's working hours with its remaining capacity, counting overlapping bookings. With session, returns that session's totals.",
+        "parameters": [
+          { "in": "query", "name": "date",      "required": true, "schema": { "type": "string", "format": "date" }, "description": "Clinic day (YYYY-MM-DD)" },
+          { "in": "query", "name": "doctor_id", "schema": { "type": "string" }, "description": "Doctor to list slots for" },
+          { "in": "query", "name": "session",   "schema": { "type": "string", "enum": ["morning","afternoon"] }, "description": "Session to report on" }
+        ],
+        "responses": {
+          "200": { "description": "DoctorAvailability (doctor_id) or SessionAvailability (session)", "content": { "application/json": { "schema": { "oneOf": [
+            { "$ref": "#/components/schemas/DoctorAvailability" },
+            { "$ref": "#/components/schemas/SessionAvailability" }
+          ] } } } },
+          "400": { "description": "Missing date, or neither/both of doctor_id and session" },
+          "404": { "description": "Doctor not found" }
+        }
+      }
+    },
+    "/appointments/waitlist": {
+      "get": {
+        "summary": "List waitlist entries",
+        "tags": ["Waitlist"],
+        "parameters": [
+          { "in": "query", "name": "patient_id", "schema": { "type": "string" } },
+          { "in": "query", "name": "doctor_id",  "schema": { "type": "string" } },
+          { "in": "query", "name": "status",     "schema": { "type": "string", "enum": ["waiting","promoted","cancelled"] } },
+          { "$ref": "#/components/parameters/IfNoneMatch" }
+        ],
+        "responses": {
+          "304": { "description": "Unchanged since the If-None-Match ETag" },
+          "403": { "description": "Patient filtered by another patient_id, or doctor filtered by another doctor_id" },
+          "200": { "description": "Entries, oldest first", "content": { "application/json": { "schema": { "type": "array", "items": { "$ref": "#/components/schemas/WaitlistEntry" } } } } }
+        }
+      },
+      "post": {
+        "summary": "Join the waitlist for a full slot or session",
+        "tags": ["Waitlist"],
+        "description": "Same body as POST /appointments. When a cancellation, no-show or reschedule frees capacity, the earliest eligible entry is booked automatically and a waitlist_promoted event is added to the new appointment's history. Joining, leaving and promotion are recorded in the entry's history (GET /appointments/waitlist/{entry_id}/history).",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "required": ["patient_id"],
+                "properties": {
+                  "patient_id":       { "type": "string" },
+                  "doctor_id":        { "type": "string", "nullable": true },
+                  "start_time":       { "type": "string", "format": "date-time", "nullable": true },
+                  "duration_minutes": { "type": "integer", "nullable": true },
+                  "session":          { "type": "string", "enum": ["morning","afternoon"], "nullable": true },
+                  "appointment_date": { "type": "string", "format": "date", "nullable": true, "description": "Required with session" },
+                  "notes":            { "type": "string", "nullable": true }
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "403": { "description": "Patients can only join for themselves" },
+          "201": { "description": "Waitlist entry", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/WaitlistEntry" } } } },
           "400": { "description": "Validation error" },
-          "409": { "description": "Slot full for this doctor" }
+          "409": { "description": "Slot still has capacity, or patient already waiting for it" },
+          "422": { "description": "The slot is outside the role's booking lead time or horizon", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/PolicyError" } } } }
+        }
+      }
+    },
+    "/appointments/waitlist/{entry_id}": {
+      "delete": {
+        "summary": "Leave the waitlist",
+        "tags": ["Waitlist"],
+        "parameters": [{ "in": "path", "name": "entry_id", "required": true, "schema": { "type": "string", "format": "uuid" } }],
+        "responses": {
+          "403": { "description": "Not the caller's entry" },
+          "200": { "description": "Cancelled entry", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/WaitlistEntry" } } } },
+          "409": { "description": "Entry not found or no longer waiting" }
+        }
+      }
+    },
+    "/appointments/waitlist/{entry_id}/history": {
+      "get": {
+        "summary": "Get the audit trail for a waitlist entry",
+        "tags": ["Waitlist"],
+        "description": "waitlist_joined, waitlist_left and waitlist_promoted events, oldest first. A promotion names the booked appointment, whose own history continues from there.",
+        "parameters": [
+          { "in": "path", "name": "entry_id", "required": true, "schema": { "type": "string", "format": "uuid" } },
+          { "$ref": "#/components/parameters/IfNoneMatch" }
+        ],
+        "responses": {
+          "304": { "description": "Unchanged since the If-None-Match ETag" },
+          "200": { "description": "Events, oldest first", "content": { "application/json": { "schema": { "type": "array", "items": { "$ref": "#/components/schemas/AppointmentEvent" } } } } },
+          "403": { "description": "Not the caller's entry" },
+          "404": { "description": "Waitlist entry not found" }
+        }
+      }
+    },
+    "/appointments/queue-snapshot": {
+      "put": {
+        "summary": "Replace queue positions and estimated times for one queue",
+        "tags": ["Queue"],
+        "description": "The snapshot is the whole queue of one doctor or session on one clinic day, in queue order. Active appointments of that queue missing from it have queue_position and estimated_time cleared. version must be greater than the last applied version for the queue. Staff, admins, or services with appointments:write-queue.",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "required": ["date", "version", "entries"],
+                "properties": {
+                  "doctor_id": { "type": "string", "nullable": true },
+                  "session":   { "type": "string", "enum": ["morning","afternoon"], "nullable": true },
+                  "date":      { "type": "string", "format": "date" },
+                  "version":   { "type": "integer", "format": "int64", "minimum": 1 },
+                  "entries": {
+                    "type": "array",
+                    "items": {
+                      "type": "object",
+                      "required": ["appointment_id"],
+                      "properties": {
+                        "appointment_id": { "type": "string", "format": "uuid" },
+                        "queue_position": { "type": "integer", "minimum": 1, "description": "Defaults to the entry's 1-based index" },
+                        "estimated_time": { "type": "string", "format": "date-time", "nullable": true }
+                      }
+                    }
+                  }
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "Applied; appointments whose queue fields changed",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "version": { "type": "integer", "format": "int64" },
+                    "changed": { "type": "array", "items": { "$ref": "#/components/schemas/Appointment" } }
+                  }
+                }
+              }
+            }
+          },
+          "400": { "description": "Validation error, or entries that are not active appointments of this queue" },
+          "403": { "description": "Not staff/admin and no appointments:write-queue scope" },
+          "409": { "description": "Stale snapshot; body includes current_version" }
+        }
+      }
+    },
+    "/appointments/session-capacity": {
+      "put": {
+        "summary": "Set the capacity of a session on a date",
+        "tags": ["Capacity"],
+        "description": "Overrides SESSION_CAPACITY_DEFAULT for one morning or afternoon session.",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "required": ["date","session","capacity"],
+                "properties": {
+                  "date":     { "type": "string", "format": "date" },
+                  "session":  { "type": "string", "enum": ["morning","afternoon"] },
+                  "capacity": { "type": "integer", "minimum": 0 }
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "403": { "description": "Staff or admin only" },
+          "200": { "description": "Capacity saved" },
+          "400": { "description": "Validation error" }
+        }
+      }
+    },
+    "/appointments/doctors/{doctor_id}/slot-settings": {
+      "patch": {
+        "summary": "Update a doctor's slot capacity, slot length and default duration",
+        "tags": ["Schedule"],
+        "parameters": [{ "in": "path", "name": "doctor_id", "required": true, "schema": { "type": "string" } }],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "slot_capacity":            { "type": "integer", "minimum": 1 },
+                  "slot_minutes":             { "type": "integer", "minimum": 5, "maximum": 240 },
+                  "default_duration_minutes": { "type": "integer", "minimum": 5 }
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "403": { "description": "Staff or admin only" },
+          "200": { "description": "Updated doctor", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Doctor" } } } },
+          "400": { "description": "Validation error" },
+          "404": { "description": "Doctor not found" }
+        }
+      }
+    },
+    "/appointments/doctors/{doctor_id}/working-hours": {
+      "get": {
+        "summary": "Get a doctor's weekly working hours",
+        "tags": ["Schedule"],
+        "parameters": [{ "in": "path", "name": "doctor_id", "required": true, "schema": { "type": "string" } }],
+        "responses": {
+          "200": { "description": "Working windows; empty means the default session hours Monday to Saturday", "content": { "application/json": { "schema": { "type": "array", "items": { "$ref": "#/components/schemas/WorkingHours" } } } } }
+        }
+      },
+      "put": {
+        "summary": "Replace a doctor's weekly working hours",
+        "tags": ["Schedule"],
+        "parameters": [{ "in": "path", "name": "doctor_id", "required": true, "schema": { "type": "string" } }],
+        "requestBody": {
+          "required": true,
+          "content": { "application/json": { "schema": { "type": "array", "items": { "$ref": "#/components/schemas/WorkingHours" } } } }
+        },
+        "responses": {
+          "403": { "description": "Staff or admin only" },
+          "200": { "description": "Saved working hours" },
+          "400": { "description": "Invalid or overlapping windows" },
+          "404": { "description": "Doctor not found" }
+        }
+      }
+    },
+    "/appointments/closures": {
+      "get": {
+        "summary": "List clinic closures",
+        "tags": ["Schedule"],
+        "parameters": [
+          { "in": "query", "name": "from", "schema": { "type": "string", "format": "date" } },
+          { "in": "query", "name": "to",   "schema": { "type": "string", "format": "date" } }
+        ],
+        "responses": {
+          "200": { "description": "Closures ordered by date", "content": { "application/json": { "schema": { "type": "array", "items": { "$ref": "#/components/schemas/ClinicClosure" } } } } }
+        }
+      }
+    },
+    "/appointments/closures/{date}": {
+      "put": {
+        "summary": "Close the clinic on a date",
+        "tags": ["Schedule"],
+        "parameters": [{ "in": "path", "name": "date", "required": true, "schema": { "type": "string", "format": "date" } }],
+        "requestBody": {
+          "required": false,
+          "content": { "application/json": { "schema": { "type": "object", "properties": { "reason": { "type": "string", "nullable": true } } } } }
+        },
+        "responses": {
+          "403": { "description": "Staff or admin only" },
+          "200": { "description": "Closure saved", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/ClinicClosure" } } } },
+          "400": { "description": "Invalid date" }
+        }
+      },
+      "delete": {
+        "summary": "Reopen the clinic on a date",
+        "tags": ["Schedule"],
+        "parameters": [{ "in": "path", "name": "date", "required": true, "schema": { "type": "string", "format": "date" } }],
+        "responses": {
+          "403": { "description": "Staff or admin only" },
+          "204": { "description": "Closure removed" },
+          "404": { "description": "No closure on that date" }
         }
       }
     },
@@ -89,19 +535,154 @@ const SwaggerJSON = `{
       "get": {
         "summary": "Get one appointment by ID",
         "tags": ["Appointments"],
-        "parameters": [{ "in": "path", "name": "id", "required": true, "schema": { "type": "string", "format": "uuid" } }],
+        "description": "The ETag response header identifies this version of the appointment; send it back as If-Match on status changes, cancellation and reschedule.",
+        "parameters": [
+          { "in": "path", "name": "id", "required": true, "schema": { "type": "string", "format": "uuid" } },
+          { "$ref": "#/components/parameters/IfNoneMatch" }
+        ],
         "responses": {
+          "403": { "description": "Not the caller's appointment" },
           "200": { "description": "Appointment object", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Appointment" } } } },
+          "304": { "description": "Unchanged since the If-None-Match ETag" },
           "404": { "description": "Appointment not found" }
         }
       },
       "delete": {
         "summary": "Cancel an appointment",
         "tags": ["Appointments"],
-        "parameters": [{ "in": "path", "name": "id", "required": true, "schema": { "type": "string", "format": "uuid" } }],
+        "parameters": [
+          { "in": "path", "name": "id", "required": true, "schema": { "type": "string", "format": "uuid" } },
+          { "$ref": "#/components/parameters/IfMatch" }
+        ],
+        "requestBody": {
+          "required": false,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "reason_code": { "type": "string", "enum": ["patient_request","clinic_closure","doctor_unavailable","system_rollback","duplicate"], "nullable": true, "description": "Stored as the appointment's cancellation_reason" },
+                  "reason":      { "type": "string", "nullable": true, "description": "Free text, stored as cancellation_note" }
+                }
+              }
+            }
+          }
+        },
         "responses": {
+          "403": { "description": "Not the caller's appointment" },
           "200": { "description": "Cancelled appointment" },
-          "409": { "description": "Appointment not found or already finalised" }
+          "400": { "description": "Unknown reason_code" },
+          "404": { "description": "Appointment not found" },
+          "409": { "description": "Appointment cannot be cancelled from its current status", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/TransitionError" } } } },
+          "412": { "description": "If-Match does not match the current ETag (returned in the ETag header)" },
+          "422": { "description": "Too close to the appointment's start for the role's cancellation cutoff (bookings made within the role's undo window are exempt)", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/PolicyError" } } } }
+        }
+      }
+    },
+    "/appointments/{id}/reschedule": {
+      "patch": {
+        "summary": "Move an appointment to a new slot",
+        "tags": ["Appointments"],
+        "description": "Keeps the appointment ID. Provide 'start_time' (with optional 'doctor_id', defaulting to the current doctor) or 'session' (with optional 'appointment_date', defaulting to the current day). Only scheduled appointments can be moved; the queue position and ETA are cleared.",
+        "parameters": [
+          { "in": "path", "name": "id", "required": true, "schema": { "type": "string", "format": "uuid" } },
+          { "$ref": "#/components/parameters/IfMatch" }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "doctor_id":  { "type": "string", "nullable": true },
+                  "start_time": { "type": "string", "format": "date-time", "nullable": true },
+                  "duration_minutes": { "type": "integer", "nullable": true, "description": "Defaults to the current duration" },
+                  "session":    { "type": "string", "enum": ["morning","afternoon"], "nullable": true },
+                  "appointment_date": { "type": "string", "format": "date", "nullable": true },
+                  "reason":     { "type": "string", "nullable": true }
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "403": { "description": "Not the caller's appointment" },
+          "200": { "description": "Rescheduled appointment", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Appointment" } } } },
+          "400": { "description": "Validation error, clinic closed, or outside the doctor's working hours" },
+          "404": { "description": "Appointment not found" },
+          "409": { "description": "Appointment is not scheduled, the new slot is full, or a patient rule was broken", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/BookingConflict" } } } },
+          "412": { "description": "If-Match does not match the current ETag (returned in the ETag header)" },
+          "422": { "description": "The current slot is within the role's cancellation cutoff, or the new one is outside its lead time or horizon", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/PolicyError" } } } }
+        }
+      }
+    },
+    "/appointments/{id}/check-in-code": {
+      "post": {
+        "summary": "Issue a check-in code for a scheduled appointment",
+        "tags": ["Appointments"],
+        "description": "Returns a short-lived signed code (CHECK_IN_CODE_TTL, default 5m) for the patient to present at a front-desk kiosk. A code checks the patient in once; it stops working when the appointment changes (e.g. is rescheduled), and a new one must be requested. Only the patient and staff or admins may request one. Only issued while the check-in window is open: from CHECK_IN_OPENS_BEFORE (default 1h) before the start_time or session start until the appointment would be marked no_show.",
+        "parameters": [
+          { "in": "path", "name": "id", "required": true, "schema": { "type": "string", "format": "uuid" } }
+        ],
+        "responses": {
+          "201": { "description": "Check-in code", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/CheckInCode" } } } },
+          "403": { "description": "Not the caller's appointment, or a doctor or service" },
+          "404": { "description": "Appointment not found" },
+          "409": { "description": "Appointment is not scheduled" },
+          "422": { "description": "Outside the check-in window (code check_in_not_open with opens_at, or check_in_closed with closed_at)", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/PolicyError" } } } },
+          "503": { "description": "CHECK_IN_SECRET is not configured" }
+        }
+      }
+    },
+    "/appointments/{id}/check-in": {
+      "post": {
+        "summary": "Check a patient in at the front desk",
+        "tags": ["Appointments"],
+        "description": "Called by a kiosk (staff, or a service with appointments:write-status) with the code from /check-in-code, proving the patient is present. Moves the appointment to checked_in and records checked_in_at and checked_in_kiosk. For doctor bookings it also sets checked_in_late, true when the patient arrives more than CHECK_IN_LATE_AFTER (default 10m) after start_time; session bookings leave it null. The appointment.checked_in event carries kiosk: true, and late for doctor bookings.",
+        "parameters": [
+          { "in": "path", "name": "id", "required": true, "schema": { "type": "string", "format": "uuid" } },
+          { "$ref": "#/components/parameters/IfMatch" }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "required": ["code"],
+                "properties": {
+                  "code": { "type": "string" }
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": { "description": "Checked-in appointment", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Appointment" } } } },
+          "400": { "description": "Missing code, or code invalid for this appointment (check_in_code_invalid) or expired (check_in_code_expired)" },
+          "403": { "description": "Only staff and services with appointments:write-status may check patients in" },
+          "404": { "description": "Appointment not found" },
+          "409": { "description": "The code was already redeemed or the appointment has changed since it was issued (check_in_code_used), or the appointment is not scheduled", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/TransitionError" } } } },
+          "412": { "description": "If-Match does not match the current ETag (returned in the ETag header)" },
+          "422": { "description": "Outside the check-in window", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/PolicyError" } } } },
+          "503": { "description": "CHECK_IN_SECRET is not configured" }
+        }
+      }
+    },
+    "/appointments/{id}/history": {
+      "get": {
+        "summary": "Get the audit trail for an appointment",
+        "tags": ["Appointments"],
+        "parameters": [
+          { "in": "path", "name": "id", "required": true, "schema": { "type": "string", "format": "uuid" } },
+          { "$ref": "#/components/parameters/IfNoneMatch" }
+        ],
+        "responses": {
+          "304": { "description": "Unchanged since the If-None-Match ETag" },
+          "403": { "description": "Not the caller's appointment" },
+          "200": { "description": "Events, oldest first", "content": { "application/json": { "schema": { "type": "array", "items": { "$ref": "#/components/schemas/AppointmentEvent" } } } } },
+          "404": { "description": "Appointment not found" }
         }
       }
     },
@@ -109,7 +690,11 @@ const SwaggerJSON = `{
       "patch": {
         "summary": "Update appointment status",
         "tags": ["Appointments"],
-        "parameters": [{ "in": "path", "name": "id", "required": true, "schema": { "type": "string", "format": "uuid" } }],
+        "description": "Allowed transitions: scheduled → checked_in | cancelled | no_show; checked_in → in_progress | cancelled | no_show; in_progress → completed. completed, cancelled and no_show are final. Scheduled appointments still not checked in NO_SHOW_GRACE (default 30m) after their start_time, or after the end of their session, are moved to no_show automatically. Patients are checked in by redeeming a kiosk code (POST /appointments/{id}/check-in); only services with appointments:write-status may set checked_in here.",
+        "parameters": [
+          { "in": "path", "name": "id", "required": true, "schema": { "type": "string", "format": "uuid" } },
+          { "$ref": "#/components/parameters/IfMatch" }
+        ],
         "requestBody": {
           "required": true,
           "content": {
@@ -118,16 +703,22 @@ const SwaggerJSON = `{
                 "type": "object",
                 "required": ["status"],
                 "properties": {
-                  "status": { "type": "string", "enum": ["scheduled","checked_in","in_progress","completed","cancelled","no_show"] }
+                  "status": { "type": "string", "enum": ["scheduled","checked_in","in_progress","completed","cancelled","no_show"] },
+                  "reason": { "type": "string", "nullable": true, "description": "Recorded in the appointment history, and as cancellation_note when cancelling" },
+                  "reason_code": { "type": "string", "enum": ["patient_request","clinic_closure","doctor_unavailable","system_rollback","duplicate"], "nullable": true, "description": "Only with status cancelled" }
                 }
               }
             }
           }
         },
         "responses": {
+          "403": { "description": "Only staff, doctors and services with appointments:write-status may change status; doctors only for their own or unassigned session bookings. checked_in is reserved for services with appointments:write-status" },
           "200": { "description": "Updated appointment" },
-          "400": { "description": "Invalid status" },
-          "404": { "description": "Appointment not found" }
+          "400": { "description": "Invalid status, or a reason_code that is unknown or sent without status cancelled" },
+          "404": { "description": "Appointment not found" },
+          "409": { "description": "Illegal status transition", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/TransitionError" } } } },
+          "412": { "description": "If-Match does not match the current ETag (returned in the ETag header)" },
+          "422": { "description": "Cancelling within the role's cancellation cutoff", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/PolicyError" } } } }
         }
       }
     }
@@ -0,0 +1,105 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Exchange is the clinic-wide topic exchange every service publishes to.
+const Exchange = "clinic.events"
+
+// AMQPPublisher publishes to Exchange with publisher confirms. It connects lazily and
+// reconnects on the next Publish after any channel or connection failure.
+type AMQPPublisher struct {
+	url string
+
+	mu   sync.Mutex
+	conn *amqp.Connection
+	ch   *amqp.Channel
+}
+
+func NewAMQPPublisher(url string) *AMQPPublisher {
+	return &AMQPPublisher{url: url}
+}
+
+func (p *AMQPPublisher) Publish(ctx context.Context, msg Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.connect(); err != nil {
+		return err
+	}
+	confirm, err := p.ch.PublishWithDeferredConfirmWithContext(ctx, Exchange, msg.RoutingKey, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.ID,
+		Timestamp:    msg.CreatedAt,
+		Type:         msg.RoutingKey,
+		AppId:        "appointment-service",
+		Body:         msg.Body,
+	})
+	if err != nil {
+		p.reset()
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		p.reset()
+		return fmt.Errorf("waiting for broker confirm: %w", err)
+	}
+	if !acked {
+		return errors.New("broker nacked the message")
+	}
+	return nil
+}
+
+// connect (re)opens the connection and a confirm-mode channel if needed. p.mu must be held.
+func (p *AMQPPublisher) connect() error {
+	if p.ch != nil && !p.ch.IsClosed() {
+		return nil
+	}
+	p.reset()
+
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return fmt.Errorf("connecting to RabbitMQ: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if err := ch.ExchangeDeclare(Exchange, "topic", true, false, false, false, nil); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return err
+	}
+	p.conn, p.ch = conn, ch
+	return nil
+}
+
+// reset drops the current connection. p.mu must be held.
+func (p *AMQPPublisher) reset() {
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn, p.ch = nil, nil
+}
+
+// Close closes the connection, if any.
+func (p *AMQPPublisher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reset()
+}
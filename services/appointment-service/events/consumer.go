@@ -0,0 +1,222 @@
+package events
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Handler processes one consumed message. Returning an error wrapped with Permanent sends
+// the message to the dead-letter queue; any other error retries it, up to the consumer's
+// maxAttempts.
+type Handler func(ctx context.Context, msg Message) error
+
+// permanentError marks a message that can never succeed, such as malformed JSON or an
+// unknown appointment.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the consumer dead-letters the message instead of retrying it.
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent.
+func IsPermanent(err error) bool {
+	var perm *permanentError
+	return errors.As(err, &perm)
+}
+
+// Consumer binds a durable queue to Exchange and feeds its messages to a Handler.
+// Poison messages go to "<queue>.dlq" through the default exchange, so they never mix with
+// other services' dead letters.
+type Consumer struct {
+	url         string
+	queue       string
+	routingKeys []string
+	handle      Handler
+	prefetch    int
+	maxAttempts int
+}
+
+func NewConsumer(url, queue string, routingKeys []string, handle Handler, maxAttempts int) *Consumer {
+	return &Consumer{url: url, queue: queue, routingKeys: routingKeys, handle: handle, prefetch: 10, maxAttempts: maxAttempts}
+}
+
+// Headers a retried message is republished with. A classic queue doesn't count
+// redeliveries, so the consumer counts attempts itself; retries go back to the queue
+// through the default exchange, which would otherwise lose the original routing key.
+const (
+	headerAttempts   = "x-attempts"
+	headerRoutingKey = "x-original-routing-key"
+)
+
+// Run consumes until ctx is done, reconnecting with backoff when the connection drops.
+func (c *Consumer) Run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		err := c.consume(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("event consumer %s: %v (reconnecting in %s)", c.queue, err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRelayBackoff)
+	}
+}
+
+func (c *Consumer) consume(ctx context.Context) error {
+	conn, err := amqp.Dial(c.url)
+	if err != nil {
+		return fmt.Errorf("connecting to RabbitMQ: %w", err)
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+
+	dlq := c.queue + ".dlq"
+	if err := ch.ExchangeDeclare(Exchange, "topic", true, false, false, false, nil); err != nil {
+		return err
+	}
+	if _, err := ch.QueueDeclare(dlq, true, false, false, false, nil); err != nil {
+		return err
+	}
+	if _, err := ch.QueueDeclare(c.queue, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": dlq,
+	}); err != nil {
+		return err
+	}
+	for _, key := range c.routingKeys {
+		if err := ch.QueueBind(c.queue, key, Exchange, false, nil); err != nil {
+			return err
+		}
+	}
+	if err := ch.Confirm(false); err != nil {
+		return err
+	}
+	if err := ch.Qos(c.prefetch, 0, false); err != nil {
+		return err
+	}
+	deliveries, err := ch.Consume(c.queue, "appointment-service", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("event consumer listening on %s", c.queue)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case d, ok := <-deliveries:
+			if !ok {
+				return errors.New("delivery channel closed")
+			}
+			c.dispatch(ctx, ch, d)
+		}
+	}
+}
+
+func (c *Consumer) dispatch(ctx context.Context, ch *amqp.Channel, d amqp.Delivery) {
+	routingKey := d.RoutingKey
+	if key, ok := d.Headers[headerRoutingKey].(string); ok {
+		routingKey = key
+	}
+	msg := Message{ID: eventID(d, routingKey), RoutingKey: routingKey, Body: d.Body, CreatedAt: d.Timestamp}
+	err := c.handle(ctx, msg)
+	attempts := deliveryAttempts(d) + 1
+
+	switch {
+	case err == nil:
+		d.Ack(false)
+	case IsPermanent(err):
+		log.Printf("event %s %s dead-lettered: %v", msg.RoutingKey, msg.ID, err)
+		d.Nack(false, false)
+	case attempts >= c.maxAttempts:
+		log.Printf("event %s %s dead-lettered after %d attempts: %v", msg.RoutingKey, msg.ID, attempts, err)
+		d.Nack(false, false)
+	default:
+		log.Printf("event %s %s failed (attempt %d of %d), retrying: %v", msg.RoutingKey, msg.ID, attempts, c.maxAttempts, err)
+		// brief pause so a failing dependency isn't hammered by immediate redelivery
+		time.Sleep(time.Second)
+		if err := c.retry(ctx, ch, d, routingKey, attempts); err != nil {
+			// keep the message rather than lose it; the attempt just goes uncounted
+			log.Printf("event %s %s could not be requeued with its attempt count: %v", msg.RoutingKey, msg.ID, err)
+			d.Nack(false, true)
+			return
+		}
+		d.Ack(false)
+	}
+}
+
+// retry puts a copy of d at the back of the queue with its attempt count, waiting for the
+// broker to confirm it before the original is acked.
+func (c *Consumer) retry(ctx context.Context, ch *amqp.Channel, d amqp.Delivery, routingKey string, attempts int) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[headerAttempts] = int32(attempts)
+	headers[headerRoutingKey] = routingKey
+
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", c.queue, false, false, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  d.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    d.MessageId,
+		Timestamp:    d.Timestamp,
+		Type:         d.Type,
+		AppId:        d.AppId,
+		Body:         d.Body,
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return errors.New("broker nacked the retry")
+	}
+	return nil
+}
+
+// deliveryAttempts is how many times d has already failed, from the header retry sets.
+func deliveryAttempts(d amqp.Delivery) int {
+	switch n := d.Headers[headerAttempts].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+// eventID is the delivery's message-id, or for publishers that don't set one, a hash of
+// routing key and body. Redeliveries and retries of the same message therefore share an ID.
+func eventID(d amqp.Delivery, routingKey string) string {
+	if d.MessageId != "" {
+		return d.MessageId
+	}
+	sum := sha256.Sum256(append([]byte(routingKey+"\x00"), d.Body...))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,175 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Message is one outbox row on its way to the broker. ID is stable across retries and is
+// sent as the AMQP message-id so consumers can drop duplicates.
+type Message struct {
+	ID         string
+	RoutingKey string
+	Body       []byte
+	CreatedAt  time.Time
+}
+
+// Publisher delivers messages to the broker. Publish must return only once the broker has
+// accepted the message. AMQPPublisher is the production implementation; tests can relay
+// into an in-process fake.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// Relay drains the appointments.outbox table into a Publisher in insertion order. Delivery
+// is at least once: a crash between publish and marking the row resends it with the same ID.
+type Relay struct {
+	db        *sql.DB
+	pub       Publisher
+	batchSize int
+	interval  time.Duration // poll interval while the outbox is empty
+	retention time.Duration // published rows older than this are deleted
+}
+
+func NewRelay(db *sql.DB, pub Publisher, batchSize int, interval, retention time.Duration) *Relay {
+	return &Relay{db: db, pub: pub, batchSize: batchSize, interval: interval, retention: retention}
+}
+
+const maxRelayBackoff = time.Minute
+
+// Run relays until ctx is done. Publish failures back off exponentially up to a minute;
+// the failing message stays at the head of the outbox so ordering is kept.
+func (r *Relay) Run(ctx context.Context) {
+	backoff := r.interval
+	lastPrune := time.Time{}
+	for {
+		n, err := r.RelayOnce(ctx)
+		wait := r.interval
+		switch {
+		case err != nil:
+			log.Printf("outbox relay: %v (retrying in %s)", err, backoff)
+			wait = backoff
+			backoff = min(backoff*2, maxRelayBackoff)
+		case n == r.batchSize:
+			wait = 0 // more waiting; keep draining
+			backoff = r.interval
+		default:
+			backoff = r.interval
+		}
+
+		if time.Since(lastPrune) > time.Hour {
+			if err := r.prune(ctx); err != nil {
+				log.Printf("outbox relay: prune failed: %v", err)
+			}
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// RelayOnce publishes up to batchSize pending messages and returns how many were sent.
+// Only one relay across all replicas works at a time, so replicas never publish out of
+// order against each other.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var leader bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT pg_try_advisory_xact_lock(hashtext('appointments.outbox'))
+	`).Scan(&leader); err != nil {
+		return 0, err
+	}
+	if !leader {
+		return 0, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id::text, routing_key, payload::text, created_at
+		FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY seq
+		LIMIT $1
+	`, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+	var batch []Message
+	for rows.Next() {
+		var m Message
+		var body string
+		if err := rows.Scan(&m.ID, &m.RoutingKey, &body, &m.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		m.Body = []byte(body)
+		batch = append(batch, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent, pubErr := r.publishBatch(ctx, tx, batch)
+	if pubErr != nil && !errors.Is(pubErr, errPublish) {
+		return sent, pubErr
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return sent, pubErr
+}
+
+// errPublish marks publishBatch errors that came from the broker rather than the database;
+// those still commit, so the attempt is recorded on the failing row.
+var errPublish = errors.New("publish failed")
+
+// execer is the part of *sql.Tx publishBatch needs.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// publishBatch publishes batch in order, marking each row as it is accepted, and stops at
+// the first failure, recording it on that row.
+func (r *Relay) publishBatch(ctx context.Context, tx execer, batch []Message) (int, error) {
+	sent := 0
+	for _, m := range batch {
+		if pubErr := r.pub.Publish(ctx, m); pubErr != nil {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE outbox SET attempts = attempts + 1, last_error = $1 WHERE id = $2::uuid
+			`, pubErr.Error(), m.ID); err != nil {
+				return sent, err
+			}
+			return sent, fmt.Errorf("%w: %s %s: %w", errPublish, m.RoutingKey, m.ID, pubErr)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE outbox SET published_at = NOW(), attempts = attempts + 1, last_error = NULL
+			WHERE id = $1::uuid
+		`, m.ID); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func (r *Relay) prune(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM outbox
+		WHERE published_at IS NOT NULL
+		  AND published_at < NOW() - $1 * INTERVAL '1 second'
+	`, int64(r.retention.Seconds()))
+	return err
+}
@@ -0,0 +1,106 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakePublisher records what it is given and fails on the IDs listed in failOn.
+type fakePublisher struct {
+	published []Message
+	failOn    map[string]error
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, msg Message) error {
+	if err := p.failOn[msg.ID]; err != nil {
+		return err
+	}
+	p.published = append(p.published, msg)
+	return nil
+}
+
+// fakeTx records the outbox updates publishBatch makes.
+type fakeTx struct {
+	sent   []string          // ids marked published
+	failed map[string]string // id -> last_error
+	err    error             // returned from every ExecContext when set
+}
+
+func (tx *fakeTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if tx.err != nil {
+		return nil, tx.err
+	}
+	if strings.Contains(query, "published_at = NOW()") {
+		tx.sent = append(tx.sent, args[0].(string))
+	} else {
+		tx.failed[args[1].(string)] = args[0].(string)
+	}
+	return nil, nil
+}
+
+func batchOf(ids ...string) []Message {
+	var batch []Message
+	for _, id := range ids {
+		batch = append(batch, Message{ID: id, RoutingKey: "appointment.booked", Body: []byte(`{}`)})
+	}
+	return batch
+}
+
+func TestPublishBatch(t *testing.T) {
+	brokerDown := errors.New("connection refused")
+	tests := []struct {
+		name       string
+		batch      []Message
+		failOn     map[string]error
+		wantSent   []string
+		wantFailed string // id recorded with last_error, if any
+	}{
+		{"empty", nil, nil, nil, ""},
+		{"all published in order", batchOf("a", "b", "c"), nil, []string{"a", "b", "c"}, ""},
+		{"stops at the first failure", batchOf("a", "b", "c"), map[string]error{"b": brokerDown}, []string{"a"}, "b"},
+		{"head of the batch fails", batchOf("a", "b"), map[string]error{"a": brokerDown}, nil, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &fakePublisher{failOn: tt.failOn}
+			tx := &fakeTx{failed: map[string]string{}}
+			r := NewRelay(nil, pub, 100, 0, 0)
+
+			n, err := r.publishBatch(context.Background(), tx, tt.batch)
+			if n != len(tt.wantSent) {
+				t.Errorf("sent = %d, want %d", n, len(tt.wantSent))
+			}
+			if strings.Join(tx.sent, ",") != strings.Join(tt.wantSent, ",") {
+				t.Errorf("marked published = %v, want %v", tx.sent, tt.wantSent)
+			}
+			if len(pub.published) != len(tt.wantSent) {
+				t.Errorf("broker received %d messages, want %d", len(pub.published), len(tt.wantSent))
+			}
+			if tt.wantFailed == "" {
+				if err != nil || len(tx.failed) != 0 {
+					t.Fatalf("err = %v, failed rows = %v; want neither", err, tx.failed)
+				}
+				return
+			}
+			if !errors.Is(err, errPublish) || !errors.Is(err, brokerDown) {
+				t.Errorf("err = %v, want a publish error wrapping %v", err, brokerDown)
+			}
+			if got := tx.failed[tt.wantFailed]; got != brokerDown.Error() {
+				t.Errorf("last_error on %s = %q, want %q", tt.wantFailed, got, brokerDown.Error())
+			}
+		})
+	}
+}
+
+func TestPublishBatchDatabaseError(t *testing.T) {
+	dbDown := errors.New("connection reset")
+	r := NewRelay(nil, &fakePublisher{}, 100, 0, 0)
+
+	_, err := r.publishBatch(context.Background(), &fakeTx{err: dbDown}, batchOf("a"))
+	if !errors.Is(err, dbDown) || errors.Is(err, errPublish) {
+		t.Fatalf("err = %v, want the database error so the batch is rolled back", err)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"appointment-service/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// errForbidden is the body returned when the caller's role does not allow the request.
+var errForbidden = gin.H{"error": "not allowed to access this appointment"}
+
+// canAccess reports whether the caller may see an appointment of patientID with doctorID:
+// patients only their own, doctors the ones booked with them and unassigned session
+// bookings, staff and admins everything, services with the read scope everything.
+func canAccess(c *gin.Context, patientID string, doctorID *string) bool {
+	switch middleware.Role(c) {
+	case middleware.RoleService:
+		return middleware.HasScope(c, middleware.ScopeRead)
+	case middleware.RoleDoctor:
+		return doctorOversees(c, doctorID)
+	}
+	return ownsOrManages(c, patientID, doctorID)
+}
+
+// canModify is canAccess for cancelling and rescheduling; services need the write scope.
+func canModify(c *gin.Context, patientID string, doctorID *string) bool {
+	if middleware.IsService(c) {
+		return middleware.HasScope(c, middleware.ScopeWrite)
+	}
+	return ownsOrManages(c, patientID, doctorID)
+}
+
+func ownsOrManages(c *gin.Context, patientID string, doctorID *string) bool {
+	switch middleware.Role(c) {
+	case middleware.RoleStaff, middleware.RoleAdmin:
+		return true
+	case middleware.RoleDoctor:
+		return doctorID != nil && *doctorID == actorID(c)
+	default:
+		return patientID == actorID(c)
+	}
+}
+
+// canIssueCheckInCode reports whether the caller may get a check-in code for an appointment
+// of patientID: the patient, or staff and admins at the front desk. A code vouches that the
+// patient is present, so doctors and services never get one.
+func canIssueCheckInCode(c *gin.Context, patientID string) bool {
+	switch middleware.Role(c) {
+	case middleware.RoleStaff, middleware.RoleAdmin:
+		return true
+	case middleware.RolePatient:
+		return patientID == actorID(c)
+	default:
+		return false
+	}
+}
+
+// canMarkCheckedIn reports whether the caller may move an appointment to checked_in with
+// PATCH /:id/status. People check patients in by redeeming a kiosk code, which proves the
+// patient is at the clinic, so only services with the write-status scope may set it directly.
+func canMarkCheckedIn(c *gin.Context) bool {
+	return middleware.HasScope(c, middleware.ScopeWriteStatus)
+}
+
+// canChangeStatus reports whether the caller may drive an appointment's status. Only staff,
+// doctors and services with the write-status scope may; doctors are limited to their own
+// and to unassigned session bookings, which they see once the patient reaches them in the
+// queue.
+func canChangeStatus(c *gin.Context, doctorID *string) bool {
+	switch middleware.Role(c) {
+	case middleware.RoleService:
+		return middleware.HasScope(c, middleware.ScopeWriteStatus)
+	case middleware.RoleStaff, middleware.RoleAdmin:
+		return true
+	case middleware.RoleDoctor:
+		return doctorOversees(c, doctorID)
+	default:
+		return false
+	}
+}
+
+// doctorOversees reports whether the calling doctor sees and drives an appointment with
+// doctorID: their own, and unassigned session bookings, which any doctor may take once the
+// patient reaches the front of the queue.
+func doctorOversees(c *gin.Context, doctorID *string) bool {
+	return doctorID == nil || *doctorID == actorID(c)
+}
+
+// authorizeAppointment loads the owners of appointment id and checks them with allowed.
+// It writes the 404/403/500 response itself and returns false if the request must stop.
+func authorizeAppointment(c *gin.Context, db *sql.DB, id string, allowed func(patientID string, doctorID *string) bool) bool {
+	var patientID string
+	var doctorID *string
+	err := db.QueryRowContext(c.Request.Context(), `
+		SELECT patient_id, doctor_id FROM appointments WHERE id = $1::uuid
+	`, id).Scan(&patientID, &doctorID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "appointment not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !allowed(patientID, doctorID) {
+		c.JSON(http.StatusForbidden, errForbidden)
+		return false
+	}
+	return true
+}
+
+// scopeListFilters narrows list filters to what the caller may see. Patients are pinned to
+// their own patient_id and doctors to their own doctor_id; asking for someone else's is
+// rejected with 403 rather than silently returning an empty list. A doctor who doesn't
+// filter by doctor_id also gets unassigned session bookings, which sets *unassigned.
+// Services need the read scope.
+func scopeListFilters(c *gin.Context, patientID, doctorID *string, unassigned *bool) bool {
+	switch middleware.Role(c) {
+	case middleware.RoleService:
+		if !middleware.HasScope(c, middleware.ScopeRead) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "missing scope " + middleware.ScopeRead})
+			return false
+		}
+	case middleware.RolePatient:
+		if *patientID != "" && *patientID != actorID(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "patients can only list their own records"})
+			return false
+		}
+		*patientID = actorID(c)
+	case middleware.RoleDoctor:
+		if *doctorID != "" && *doctorID != actorID(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "doctors can only list their own records"})
+			return false
+		}
+		*unassigned = *doctorID == ""
+		*doctorID = actorID(c)
+	}
+	return true
+}
+
+// canBookFor reports whether the caller may create a booking or waitlist entry for
+// patientID. Patients may only book for themselves; services need the write scope.
+func canBookFor(c *gin.Context, patientID string) bool {
+	switch middleware.Role(c) {
+	case middleware.RoleService:
+		return middleware.HasScope(c, middleware.ScopeWrite)
+	case middleware.RolePatient:
+		return patientID == actorID(c)
+	default:
+		return true
+	}
+}
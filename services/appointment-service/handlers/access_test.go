@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"appointment-service/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// testContext is a request context authenticated as userID with role, or as a service
+// holding scopes when role is RoleService.
+func testContext(role, userID string, scopes ...string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("user_id", userID)
+	c.Set("role", role)
+	if role == middleware.RoleService {
+		c.Set("scopes", scopes)
+	}
+	return c
+}
+
+func TestAccessRoleMatrix(t *testing.T) {
+	own, other := "doc-1", "doc-2"
+	callers := []struct {
+		name string
+		c    func() *gin.Context
+	}{
+		{"patient", func() *gin.Context { return testContext(middleware.RolePatient, "pat-1") }},
+		{"other patient", func() *gin.Context { return testContext(middleware.RolePatient, "pat-2") }},
+		{"doctor", func() *gin.Context { return testContext(middleware.RoleDoctor, own) }},
+		{"staff", func() *gin.Context { return testContext(middleware.RoleStaff, "staff-1") }},
+		{"admin", func() *gin.Context { return testContext(middleware.RoleAdmin, "admin-1") }},
+		{"service read", func() *gin.Context { return testContext(middleware.RoleService, "svc", middleware.ScopeRead) }},
+		{"service write", func() *gin.Context { return testContext(middleware.RoleService, "svc", middleware.ScopeWrite) }},
+		{"service write-status", func() *gin.Context { return testContext(middleware.RoleService, "svc", middleware.ScopeWriteStatus) }},
+		{"service no scope", func() *gin.Context { return testContext(middleware.RoleService, "svc") }},
+	}
+	appointments := []struct {
+		name     string
+		doctorID *string
+	}{
+		{"own doctor booking", &own},
+		{"other doctor's booking", &other},
+		{"unassigned session booking", nil},
+	}
+	type verdict struct{ access, modify, status, checkInCode bool }
+	// want[caller][appointment], for an appointment of patient pat-1
+	want := map[string][3]verdict{
+		"patient":              {{true, true, false, true}, {true, true, false, true}, {true, true, false, true}},
+		"other patient":        {},
+		"doctor":               {{true, true, true, false}, {false, false, false, false}, {true, false, true, false}},
+		"staff":                {{true, true, true, true}, {true, true, true, true}, {true, true, true, true}},
+		"admin":                {{true, true, true, true}, {true, true, true, true}, {true, true, true, true}},
+		"service read":         {{access: true}, {access: true}, {access: true}},
+		"service write":        {{modify: true}, {modify: true}, {modify: true}},
+		"service write-status": {{status: true}, {status: true}, {status: true}},
+		"service no scope":     {},
+	}
+
+	for _, caller := range callers {
+		for i, appt := range appointments {
+			t.Run(caller.name+"/"+appt.name, func(t *testing.T) {
+				c := caller.c()
+				got := verdict{
+					access:      canAccess(c, "pat-1", appt.doctorID),
+					modify:      canModify(c, "pat-1", appt.doctorID),
+					status:      canChangeStatus(c, appt.doctorID),
+					checkInCode: canIssueCheckInCode(c, "pat-1"),
+				}
+				if w := want[caller.name][i]; got != w {
+					t.Errorf("got %+v, want %+v", got, w)
+				}
+			})
+		}
+	}
+}
+
+func TestCanBookFor(t *testing.T) {
+	tests := []struct {
+		name string
+		c    *gin.Context
+		want bool
+	}{
+		{"patient for self", testContext(middleware.RolePatient, "pat-1"), true},
+		{"patient for another", testContext(middleware.RolePatient, "pat-2"), false},
+		{"doctor", testContext(middleware.RoleDoctor, "doc-1"), true},
+		{"staff", testContext(middleware.RoleStaff, "staff-1"), true},
+		{"service with write", testContext(middleware.RoleService, "svc", middleware.ScopeWrite), true},
+		{"service with read only", testContext(middleware.RoleService, "svc", middleware.ScopeRead), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canBookFor(tt.c, "pat-1"); got != tt.want {
+				t.Errorf("canBookFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeListFilters(t *testing.T) {
+	tests := []struct {
+		name                 string
+		c                    *gin.Context
+		patientID, doctorID  string
+		wantOK               bool
+		wantPatient, wantDoc string
+		wantUnassigned       bool
+	}{
+		{"patient is pinned to self", testContext(middleware.RolePatient, "pat-1"), "", "", true, "pat-1", "", false},
+		{"patient asking for another", testContext(middleware.RolePatient, "pat-1"), "pat-2", "", false, "", "", false},
+		{"doctor without filter sees unassigned too", testContext(middleware.RoleDoctor, "doc-1"), "", "", true, "", "doc-1", true},
+		{"doctor filtering by self", testContext(middleware.RoleDoctor, "doc-1"), "", "doc-1", true, "", "doc-1", false},
+		{"doctor asking for another", testContext(middleware.RoleDoctor, "doc-1"), "", "doc-2", false, "", "", false},
+		{"staff filters freely", testContext(middleware.RoleStaff, "staff-1"), "pat-2", "doc-2", true, "pat-2", "doc-2", false},
+		{"service with read", testContext(middleware.RoleService, "svc", middleware.ScopeRead), "", "", true, "", "", false},
+		{"service without read", testContext(middleware.RoleService, "svc", middleware.ScopeWrite), "", "", false, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patientID, doctorID := tt.patientID, tt.doctorID
+			var unassigned bool
+			ok := scopeListFilters(tt.c, &patientID, &doctorID, &unassigned)
+			if ok != tt.wantOK {
+				t.Fatalf("scopeListFilters() = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if patientID != tt.wantPatient || doctorID != tt.wantDoc || unassigned != tt.wantUnassigned {
+				t.Errorf("filters = (%q, %q, %v), want (%q, %q, %v)",
+					patientID, doctorID, unassigned, tt.wantPatient, tt.wantDoc, tt.wantUnassigned)
+			}
+		})
+	}
+}
+
+func TestCanMarkCheckedIn(t *testing.T) {
+	tests := []struct {
+		name string
+		c    *gin.Context
+		want bool
+	}{
+		{"patient", testContext(middleware.RolePatient, "pat-1"), false},
+		{"doctor", testContext(middleware.RoleDoctor, "doc-1"), false},
+		{"staff", testContext(middleware.RoleStaff, "staff-1"), false},
+		{"admin", testContext(middleware.RoleAdmin, "admin-1"), false},
+		{"service with write-status", testContext(middleware.RoleService, "svc", middleware.ScopeWriteStatus), true},
+		{"service with write only", testContext(middleware.RoleService, "svc", middleware.ScopeWrite), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canMarkCheckedIn(tt.c); got != tt.want {
+				t.Errorf("canMarkCheckedIn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,78 +1,163 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"time"
 
+	"appointment-service/config"
+	"appointment-service/middleware"
 	"appointment-service/models"
 	"github.com/gin-gonic/gin"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// appointmentColumns is the SELECT/RETURNING list matched by scanAppointment.
+const appointmentColumns = `id::text, patient_id::text, doctor_id::text,
+	start_time, end_time, (EXTRACT(EPOCH FROM end_time - start_time) / 60)::int,
+	session, to_char(appointment_date, 'YYYY-MM-DD'), estimated_time, queue_position, notes,
+	status, created_at, updated_at,
+	cancellation_reason, cancellation_note, cancelled_by, cancelled_at,
+	checked_in_at, checked_in_kiosk, checked_in_late`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAppointment(row rowScanner) (models.Appointment, error) {
+	var a models.Appointment
+	err := row.Scan(
+		&a.ID, &a.PatientID, &a.DoctorID,
+		&a.StartTime, &a.EndTime, &a.Duration,
+		&a.Session, &a.Date, &a.EstimatedTime, &a.QueuePosition, &a.Notes,
+		&a.Status, &a.CreatedAt, &a.UpdatedAt,
+		&a.CancellationReason, &a.CancellationNote, &a.CancelledBy, &a.CancelledAt,
+		&a.CheckedInAt, &a.CheckedInKiosk, &a.CheckedInLate,
+	)
+	// only session bookings store their day; a doctor booking's is that of its start_time
+	if err == nil && a.Date == nil && a.StartTime != nil {
+		d := clinicDate(*a.StartTime)
+		a.Date = &d
+	}
+	return a, err
+}
+
+// GetAppointments lists appointments ordered by sort (created_at or start_time) with the ID
+// as tie-breaker, so cursors stay stable while rows are added. Paging is opt-in: with limit
+// or cursor the response is an AppointmentPage, without either it is every match as a plain
+// array, as the endpoint returned before it was paged.
 func GetAppointments(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		patientID := c.Query("patient_id")
 		doctorID := c.Query("doctor_id")
-		date := c.Query("date") // expected format: YYYY-MM-DD
+		var unassigned bool
+		if !scopeListFilters(c, &patientID, &doctorID, &unassigned) {
+			return
+		}
+		p, err := parseListParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		var nullPatient, nullDoctor, nullDate interface{}
+		var nullPatient, nullDoctor, nullStatuses, nullSession, nullFrom, nullTo interface{}
+		var nullKey, nullID, nullReasons, nullCancelledBy, nullLimit interface{}
 		if patientID != "" {
 			nullPatient = patientID
 		}
 		if doctorID != "" {
 			nullDoctor = doctorID
 		}
-		if date != "" {
-			nullDate = date
+		if len(p.statuses) > 0 {
+			nullStatuses = pq.Array(p.statuses)
+		}
+		if p.session != "" {
+			nullSession = p.session
+		}
+		if p.from != "" {
+			nullFrom = p.from
+		}
+		if p.to != "" {
+			nullTo = p.to
+		}
+		if len(p.cancelReasons) > 0 {
+			nullReasons = pq.Array(p.cancelReasons)
+		}
+		if p.cancelledBy != "" {
+			nullCancelledBy = p.cancelledBy
+		}
+		if p.after != nil {
+			nullKey, nullID = p.after.Key, p.after.ID
+		}
+		if p.paged {
+			// one extra row tells whether another page follows
+			nullLimit = p.limit + 1
 		}
 
+		key, cmp, dir := sortKeys[p.sort], ">", "ASC"
+		if p.desc {
+			cmp, dir = "<", "DESC"
+		}
 		rows, err := db.QueryContext(c.Request.Context(), `
-			SELECT id::text, patient_id::text, doctor_id::text,
-				start_time, session, estimated_time, queue_position, notes,
-				status, created_at, updated_at
+			SELECT `+appointmentColumns+`
 			FROM appointments
 			WHERE ($1::text IS NULL OR patient_id = $1)
-			  AND ($2::text IS NULL OR doctor_id = $2)
-			  AND ($3::date IS NULL OR start_time::date = $3::date)
-			ORDER BY created_at ASC
-		`, nullPatient, nullDoctor, nullDate)
+			  AND ($2::text IS NULL OR doctor_id = $2 OR ($13 AND doctor_id IS NULL))
+			  AND ($3::text[] IS NULL OR status = ANY($3))
+			  AND ($4::text IS NULL OR session = $4)
+			  AND ($5::date IS NULL OR `+appointmentDateSQL("$7")+` >= $5::date)
+			  AND ($6::date IS NULL OR `+appointmentDateSQL("$7")+` <= $6::date)
+			  AND ($11::text[] IS NULL OR cancellation_reason = ANY($11))
+			  AND ($12::text IS NULL OR cancelled_by = $12)
+			  AND ($8::timestamptz IS NULL OR (`+key+`, id) `+cmp+` ($8::timestamptz, $9::uuid))
+			ORDER BY `+key+` `+dir+`, id `+dir+`
+			LIMIT $10
+		`, nullPatient, nullDoctor, nullStatuses, nullSession, nullFrom, nullTo,
+			config.ClinicLocation().String(), nullKey, nullID, nullLimit, nullReasons, nullCancelledBy, unassigned)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		defer rows.Close()
 
-		var appts []models.Appointment
+		page := models.AppointmentPage{Items: []models.Appointment{}}
 		for rows.Next() {
-			var a models.Appointment
-			if err := rows.Scan(
-				&a.ID, &a.PatientID, &a.DoctorID,
-				&a.StartTime, &a.Session, &a.EstimatedTime, &a.QueuePosition, &a.Notes,
-				&a.Status, &a.CreatedAt, &a.UpdatedAt,
-			); err != nil {
+			a, err := scanAppointment(rows)
+			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
-			appts = append(appts, a)
+			page.Items = append(page.Items, a)
 		}
-		c.JSON(http.StatusOK, appts)
+		if err := rows.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !p.paged {
+			respondCacheable(c, page.Items)
+			return
+		}
+		if len(page.Items) > p.limit {
+			page.Items = page.Items[:p.limit]
+			last := page.Items[p.limit-1]
+			next := pageCursor{Sort: p.sort, Desc: p.desc, Key: p.sortKey(last), ID: last.ID}.encode()
+			page.NextCursor = &next
+		}
+		respondCacheable(c, page)
 	}
 }
 
 func GetAppointment(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		var a models.Appointment
-		err := db.QueryRowContext(c.Request.Context(), `
-			SELECT id::text, patient_id::text, doctor_id::text,
-				start_time, session, estimated_time, queue_position, notes,
-				status, created_at, updated_at
+		a, err := scanAppointment(db.QueryRowContext(c.Request.Context(), `
+			SELECT `+appointmentColumns+`
 			FROM appointments WHERE id = $1::uuid
-		`, id).Scan(
-			&a.ID, &a.PatientID, &a.DoctorID,
-			&a.StartTime, &a.Session, &a.EstimatedTime, &a.QueuePosition, &a.Notes,
-			&a.Status, &a.CreatedAt, &a.UpdatedAt,
-		)
+		`, id))
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "appointment not found"})
 			return
@@ -81,7 +166,11 @@ func GetAppointment(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, a)
+		if !canAccess(c, a.PatientID, a.DoctorID) {
+			c.JSON(http.StatusForbidden, errForbidden)
+			return
+		}
+		respondAppointment(c, http.StatusOK, a)
 	}
 }
 
@@ -92,74 +181,112 @@ func CreateAppointment(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if !canBookFor(c, req.PatientID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "patients can only book for themselves"})
+			return
+		}
 
-		// validate booking type: must be session-based OR specific doctor, not both/neither
-		if req.Session != nil && req.StartTime != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "provide either session or start_time+doctor_id, not both"})
+		idemKey := c.GetHeader("Idempotency-Key")
+		if !validIdempotencyKey(c, idemKey) {
 			return
 		}
-		if req.Session == nil && req.StartTime == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "provide either session (morning/afternoon) or start_time+doctor_id"})
+
+		ctx := c.Request.Context()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		defer tx.Rollback()
 
-		if req.Session != nil {
-			// session-based booking
-			if *req.Session != "morning" && *req.Session != "afternoon" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "session must be 'morning' or 'afternoon'"})
-				return
+		// a retried request under the same key gets the original 201 instead of a second booking
+		if idemKey != "" {
+			hash, err := requestHash(req)
+			if err == nil {
+				var stored *storedResponse
+				stored, err = claimIdempotencyKey(ctx, tx, idemKey, actorID(c), hash)
+				if stored != nil {
+					replayResponse(c, stored)
+					return
+				}
 			}
-		} else {
-			// specific doctor booking
-			if req.DoctorID == nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "doctor_id is required when start_time is provided"})
+			if errors.Is(err, errIdempotencyMismatch) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
 				return
 			}
-			if req.StartTime.Minute()%15 != 0 || req.StartTime.Second() != 0 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "start_time must be on a 15 minute interval"})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 		}
 
-		// atomic insert with capacity check (only applies to specific doctor bookings)
-		var a models.Appointment
-		err := db.QueryRowContext(c.Request.Context(), `
-			INSERT INTO appointments (patient_id, doctor_id, start_time, session, notes, status)
-			SELECT $1, $2::text, $3, $4, $5, $6
-			WHERE (
-				$2::text IS NULL
-				OR (
-					SELECT COUNT(*)
-					FROM appointments
-					WHERE doctor_id = $2
-					  AND start_time = $3
-					  AND status NOT IN ('cancelled', 'no_show', 'completed')
-				) < COALESCE(
-					(SELECT slot_capacity FROM doctors WHERE id = $2),
-					1
-				)
-			)
-			RETURNING id::text, patient_id::text, doctor_id::text,
-					  start_time, session, estimated_time, queue_position, notes,
-					  status, created_at, updated_at
-		`, req.PatientID, req.DoctorID, req.StartTime, req.Session, req.Notes, models.StatusScheduled).
-			Scan(
-				&a.ID, &a.PatientID, &a.DoctorID,
-				&a.StartTime, &a.Session, &a.EstimatedTime, &a.QueuePosition, &a.Notes,
-				&a.Status, &a.CreatedAt, &a.UpdatedAt,
-			)
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusConflict, gin.H{"error": "slot is full for this doctor"})
+		// validate booking type: must be session-based OR specific doctor, not both/neither.
+		// Checked after the replay, so a retry still gets its 201 once the slot is in the past.
+		if err := validateBooking(req.DoctorID, req.StartTime, req.Session, req.Date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkBookingPolicy(middleware.Role(c), req.StartTime, req.Session, req.Date); err != nil {
+			respondBookingError(c, err)
 			return
 		}
+
+		var endTime *time.Time
+		if req.DoctorID != nil {
+			var end time.Time
+			end, err = checkDoctorBooking(ctx, tx, *req.DoctorID, *req.StartTime, req.Duration, "")
+			endTime = &end
+		} else {
+			err = checkSessionSchedule(ctx, tx, *req.Date)
+			if err == nil {
+				err = checkSessionCapacity(ctx, tx, *req.Date, *req.Session, "")
+			}
+		}
+		if err == nil {
+			err = checkPatientBooking(ctx, tx, req.PatientID, req.StartTime, endTime, req.Session, req.Date, "")
+		}
 		if err != nil {
+			respondBookingError(c, err)
+			return
+		}
+
+		a, err := insertAppointment(ctx, tx, req.PatientID, req.DoctorID, req.StartTime, endTime, req.Session, req.Date, req.Notes)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordEvent(ctx, tx, a.ID, models.EventCreated, actorID(c), nil, snapshotBooking(a), nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := enqueueEvent(ctx, tx, routingBooked, a, nil, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if idemKey != "" {
+			if err := saveIdempotentResponse(ctx, tx, idemKey, actorID(c), http.StatusCreated, a); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusCreated, a)
+		respondAppointment(c, http.StatusCreated, a)
 	}
 }
 
+// insertAppointment writes a scheduled appointment. Callers run the capacity checks first,
+// in the same tx.
+func insertAppointment(ctx context.Context, tx *sql.Tx, patientID string, doctorID *string, start, end *time.Time, session, date, notes *string) (models.Appointment, error) {
+	return scanAppointment(tx.QueryRowContext(ctx, `
+		INSERT INTO appointments (patient_id, doctor_id, start_time, end_time, session, appointment_date, notes, status)
+		VALUES ($1, $2, $3, $4, $5, $6::date, $7, $8)
+		RETURNING `+appointmentColumns,
+		patientID, doctorID, start, end, session, date, notes, models.StatusScheduled))
+}
+
 func UpdateAppointmentStatus(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
@@ -168,30 +295,38 @@ func UpdateAppointmentStatus(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		var a models.Appointment
-		err := db.QueryRowContext(c.Request.Context(), `
-			UPDATE appointments
-			SET status = $1, updated_at = NOW()
-			WHERE id = $2::uuid
-			RETURNING id::text, patient_id::text, doctor_id::text,
-					  start_time, session, estimated_time, queue_position, notes,
-					  status, created_at, updated_at
-		`, req.Status, id).
-			Scan(
-				&a.ID, &a.PatientID, &a.DoctorID,
-				&a.StartTime, &a.Session, &a.EstimatedTime, &a.QueuePosition, &a.Notes,
-				&a.Status, &a.CreatedAt, &a.UpdatedAt,
-			)
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "appointment not found"})
+		if !req.Status.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid status %q", req.Status)})
+			return
+		}
+		if req.ReasonCode != nil {
+			if req.Status != models.StatusCancelled {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "reason_code is only allowed when cancelling"})
+				return
+			}
+			if !validCancellationReason(c, *req.ReasonCode) {
+				return
+			}
+		}
+		if !authorizeAppointment(c, db, id, func(_ string, doctorID *string) bool {
+			return canChangeStatus(c, doctorID)
+		}) {
+			return
+		}
+		if req.Status == models.StatusCheckedIn && !canMarkCheckedIn(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "patients are checked in with a kiosk code: POST /appointments/:id/check-in"})
+			return
+		}
+		if req.Status == models.StatusCancelled && !cancellationAllowed(c, db, id) {
 			return
 		}
+
+		a, err := changeStatus(c.Request.Context(), db, id, req.Status, actorID(c), req.Reason, req.ReasonCode, c.GetHeader("If-Match"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondStatusError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, a)
+		respondAppointment(c, http.StatusOK, a)
 	}
 }
 
@@ -199,28 +334,157 @@ func CancelAppointment(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 
-		var a models.Appointment
-		err := db.QueryRowContext(c.Request.Context(), `
-			UPDATE appointments
-			SET status = $1, updated_at = NOW()
-			WHERE id = $2::uuid AND status NOT IN ('completed', 'cancelled')
-			RETURNING id::text, patient_id::text, doctor_id::text,
-					  start_time, session, estimated_time, queue_position, notes,
-					  status, created_at, updated_at
-		`, models.StatusCancelled, id).
-			Scan(
-				&a.ID, &a.PatientID, &a.DoctorID,
-				&a.StartTime, &a.Session, &a.EstimatedTime, &a.QueuePosition, &a.Notes,
-				&a.Status, &a.CreatedAt, &a.UpdatedAt,
-			)
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusConflict, gin.H{"error": "appointment not found or already finalised"})
+		// the body is optional: DELETE without one is still a valid cancel
+		var req models.CancelRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if req.ReasonCode != nil && !validCancellationReason(c, *req.ReasonCode) {
+			return
+		}
+
+		if !authorizeAppointment(c, db, id, func(patientID string, doctorID *string) bool {
+			return canModify(c, patientID, doctorID)
+		}) {
+			return
+		}
+		if !cancellationAllowed(c, db, id) {
+			return
+		}
+
+		a, err := changeStatus(c.Request.Context(), db, id, models.StatusCancelled, actorID(c), req.Reason, req.ReasonCode, c.GetHeader("If-Match"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondStatusError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, a)
+		respondAppointment(c, http.StatusOK, a)
+	}
+}
+
+// validCancellationReason rejects an unknown reason_code with 400.
+func validCancellationReason(c *gin.Context, code models.CancellationReason) bool {
+	if code.Valid() {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   fmt.Sprintf("invalid reason_code %q", code),
+		"allowed": models.CancellationReasons,
+	})
+	return false
+}
+
+// transitionError is returned when a status change is not allowed by the lifecycle table.
+type transitionError struct {
+	From models.Status
+	To   models.Status
+}
+
+func (e *transitionError) Error() string {
+	return fmt.Sprintf("cannot change appointment status from %s to %s", e.From, e.To)
+}
+
+// changeStatus applies a single lifecycle transition in its own transaction.
+func changeStatus(ctx context.Context, db *sql.DB, id string, next models.Status, actor string, reason *string, code *models.CancellationReason, ifMatch string) (models.Appointment, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Appointment{}, err
+	}
+	defer tx.Rollback()
+
+	if err := checkIfMatch(ctx, tx, id, ifMatch); err != nil {
+		return models.Appointment{}, err
+	}
+	a, err := transitionStatus(ctx, tx, id, next, actor, reason, code)
+	if err != nil {
+		return models.Appointment{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Appointment{}, err
+	}
+	return a, nil
+}
+
+// transitionStatus locks the appointment row, checks the move against the lifecycle
+// table, writes the new status and records it in appointment_events. A cancellation also
+// stores code, reason and actor on the appointment. Returns sql.ErrNoRows if the
+// appointment does not exist and *transitionError if the move is illegal.
+func transitionStatus(ctx context.Context, tx *sql.Tx, id string, next models.Status, actor string, reason *string, code *models.CancellationReason) (models.Appointment, error) {
+	var current models.Status
+	err := tx.QueryRowContext(ctx, `
+		SELECT status FROM appointments WHERE id = $1::uuid FOR UPDATE
+	`, id).Scan(&current)
+	if err != nil {
+		return models.Appointment{}, err
+	}
+	if !current.CanTransitionTo(next) {
+		return models.Appointment{}, &transitionError{From: current, To: next}
+	}
+
+	// only a cancellation fills the cancellation columns; no other move can follow one
+	var note, cancelledBy *string
+	cancelled := next == models.StatusCancelled
+	if cancelled {
+		note = reason
+		if actor != "" {
+			cancelledBy = &actor
+		}
+	} else {
+		code = nil
+	}
+	a, err := scanAppointment(tx.QueryRowContext(ctx, `
+		UPDATE appointments
+		SET status = $1, updated_at = NOW(),
+			cancellation_reason = $3, cancellation_note = $4, cancelled_by = $5,
+			cancelled_at = CASE WHEN $6 THEN NOW() END,
+			checked_in_at = CASE WHEN $7 THEN NOW() ELSE checked_in_at END
+		WHERE id = $2::uuid
+		RETURNING `+appointmentColumns,
+		next, id, code, note, cancelledBy, cancelled, next == models.StatusCheckedIn))
+	if err != nil {
+		return models.Appointment{}, err
+	}
+
+	eventType := models.EventStatusChanged
+	if next == models.StatusCancelled {
+		eventType = models.EventCancelled
+	}
+	err = recordEvent(ctx, tx, a.ID, eventType, actor,
+		statusSnapshot{Status: current}, statusSnapshot{Status: next, ReasonCode: code}, reason)
+	if err != nil {
+		return models.Appointment{}, err
+	}
+	if key, ok := statusRoutingKeys[next]; ok {
+		if err := enqueueEvent(ctx, tx, key, a, reason, nil); err != nil {
+			return models.Appointment{}, err
+		}
+	}
+
+	// a cancelled or missed booking gives its place to the waitlist
+	if next == models.StatusCancelled || next == models.StatusNoShow {
+		if err := promoteWaitlist(ctx, tx, a); err != nil {
+			return models.Appointment{}, err
+		}
+	}
+	return a, nil
+}
+
+// respondStatusError maps errors from changeStatus onto HTTP responses.
+func respondStatusError(c *gin.Context, err error) {
+	var te *transitionError
+	var pe *preconditionError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "appointment not found"})
+	case errors.As(err, &pe):
+		respondPreconditionFailed(c, pe)
+	case errors.As(err, &te):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          te.Error(),
+			"current_status": te.From,
+			"allowed_next":   te.From.AllowedNext(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 	}
 }
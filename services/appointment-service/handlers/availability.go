@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"appointment-service/config"
+	"appointment-service/models"
+	"github.com/gin-gonic/gin"
+)
+
+// GetAvailability reports remaining capacity for a day. With doctor_id it lists every
+// slot in the doctor's working hours at the doctor's slot length; with session it returns that
+// session's totals. Closed days report closed_reason and no capacity.
+func GetAvailability(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		doctorID := c.Query("doctor_id")
+		session := c.Query("session")
+		date := c.Query("date") // expected format: YYYY-MM-DD
+
+		day, err := time.ParseInLocation(time.DateOnly, date, config.ClinicLocation())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date is required (YYYY-MM-DD)"})
+			return
+		}
+		if (doctorID == "") == (session == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "provide either doctor_id or session"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		reason, closed, err := clinicClosure(ctx, db, day)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if session != "" {
+			if _, ok := sessionHours[session]; !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "session must be 'morning' or 'afternoon'"})
+				return
+			}
+			if closed {
+				c.JSON(http.StatusOK, models.SessionAvailability{Session: session, Date: date, ClosedReason: &reason})
+				return
+			}
+			capacity, booked, err := sessionUsage(ctx, db, date, session, "")
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, models.SessionAvailability{
+				Session:   session,
+				Date:      date,
+				Capacity:  capacity,
+				Booked:    booked,
+				Remaining: max(capacity-booked, 0),
+			})
+			return
+		}
+
+		var d doctorSlots
+		err = db.QueryRowContext(ctx, `
+			SELECT slot_capacity, slot_minutes, default_duration_minutes FROM doctors WHERE id = $1
+		`, doctorID).Scan(&d.capacity, &d.slotMinutes, &d.defaultDuration)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "doctor not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if closed {
+			c.JSON(http.StatusOK, models.DoctorAvailability{
+				DoctorID: doctorID, Date: date, ClosedReason: &reason, Slots: []models.SlotAvailability{},
+			})
+			return
+		}
+		windows, err := workingWindows(ctx, db, doctorID, day)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		booked, err := bookedIntervals(ctx, db, doctorID, day, day.AddDate(0, 0, 1), "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		slots := []models.SlotAvailability{}
+		for _, start := range workingSlots(day, windows, d.slotMinutes) {
+			n := overlapping(booked, start, start.Add(d.step()))
+			slots = append(slots, models.SlotAvailability{
+				StartTime: start,
+				Capacity:  d.capacity,
+				Booked:    n,
+				Remaining: max(d.capacity-n, 0),
+			})
+		}
+		c.JSON(http.StatusOK, models.DoctorAvailability{DoctorID: doctorID, Date: date, Slots: slots})
+	}
+}
+
+// workingSlots lists the slot start times within windows on day.
+func workingSlots(day time.Time, windows []window, slotMinutes int) []time.Time {
+	var slots []time.Time
+	for _, w := range windows {
+		// windows need not start on the slot grid; slots always do
+		first := (w.start + slotMinutes - 1) / slotMinutes * slotMinutes
+		for m := first; m+slotMinutes <= w.end; m += slotMinutes {
+			slots = append(slots, time.Date(day.Year(), day.Month(), day.Day(), 0, m, 0, 0, day.Location()))
+		}
+	}
+	return slots
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"appointment-service/config"
+	"github.com/gin-gonic/gin"
+)
+
+// activeStatusFilter selects the appointments that occupy capacity.
+const activeStatusFilter = `status NOT IN ('cancelled', 'no_show', 'completed')`
+
+var (
+	errSlotFull    = errors.New("slot is full for this doctor")
+	errSessionFull = errors.New("session is full for this date")
+)
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// sessionHours are the clinic-time opening hours of each session, in minutes since
+// midnight. They match the windows shown in the booking UI.
+var sessionHours = map[string]struct{ start, end int }{
+	"morning":   {9 * 60, 12 * 60},
+	"afternoon": {14 * 60, 17 * 60},
+}
+
+// bookingError is a client-side validation failure for a requested slot.
+type bookingError struct {
+	msg string
+}
+
+func (e *bookingError) Error() string { return e.msg }
+
+// validateBooking checks the booking-type rules shared by create and reschedule:
+// either a session on an appointment_date, or a doctor_id + start_time. Slot alignment
+// depends on the doctor and is checked by checkDoctorBooking.
+func validateBooking(doctorID *string, startTime *time.Time, session, date *string) error {
+	if session != nil && startTime != nil {
+		return &bookingError{"provide either session or start_time+doctor_id, not both"}
+	}
+	if session == nil && startTime == nil {
+		return &bookingError{"provide either session (morning/afternoon) or start_time+doctor_id"}
+	}
+
+	if session != nil {
+		// session-based booking; the doctor is assigned from the queue
+		if *session != "morning" && *session != "afternoon" {
+			return &bookingError{"session must be 'morning' or 'afternoon'"}
+		}
+		if doctorID != nil {
+			return &bookingError{"doctor_id is only for start_time bookings; session bookings are not booked with a doctor"}
+		}
+		return validateSessionDate(*session, date)
+	}
+
+	// specific doctor booking
+	if doctorID == nil {
+		return &bookingError{"doctor_id is required when start_time is provided"}
+	}
+	if date != nil {
+		return &bookingError{"appointment_date is only for session bookings; a doctor booking's day comes from start_time"}
+	}
+	return nil
+}
+
+// validateSessionDate requires a session booking's appointment_date to be a clinic day
+// whose session has not ended yet.
+func validateSessionDate(session string, date *string) error {
+	if date == nil {
+		return &bookingError{"appointment_date is required for session bookings"}
+	}
+	if _, err := time.Parse(time.DateOnly, *date); err != nil {
+		return &bookingError{"appointment_date must be YYYY-MM-DD"}
+	}
+	now := time.Now()
+	today := clinicDate(now)
+	if *date < today {
+		return &bookingError{"appointment_date must be today or later"}
+	}
+	if *date == today && minuteOfDay(now) >= sessionHours[session].end {
+		return &bookingError{fmt.Sprintf("today's %s session has already ended", session)}
+	}
+	return nil
+}
+
+// doctorSlots is a doctor's booking configuration from the doctors table.
+type doctorSlots struct {
+	capacity        int // concurrent bookings per slot
+	slotMinutes     int // slot granularity
+	defaultDuration int // minutes, used when a booking does not ask for one
+}
+
+func (d doctorSlots) step() time.Duration {
+	return time.Duration(d.slotMinutes) * time.Minute
+}
+
+// lockDoctor loads the doctor's booking configuration and locks the row so concurrent
+// bookings for the same doctor serialise on it until tx ends.
+func lockDoctor(ctx context.Context, tx *sql.Tx, doctorID string) (doctorSlots, error) {
+	var d doctorSlots
+	err := tx.QueryRowContext(ctx, `
+		SELECT slot_capacity, slot_minutes, default_duration_minutes
+		FROM doctors WHERE id = $1
+		FOR UPDATE
+	`, doctorID).Scan(&d.capacity, &d.slotMinutes, &d.defaultDuration)
+	if err == sql.ErrNoRows {
+		return d, &bookingError{"doctor not found"}
+	}
+	return d, err
+}
+
+// checkDoctorBooking runs every check for a specific-doctor booking of start plus the
+// requested (or the doctor's default) duration, and returns the booking's end time.
+// excludeID skips the appointment being moved (empty for new bookings).
+func checkDoctorBooking(ctx context.Context, tx *sql.Tx, doctorID string, start time.Time, durationMinutes *int, excludeID string) (time.Time, error) {
+	d, err := lockDoctor(ctx, tx, doctorID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if minuteOfDay(start)%d.slotMinutes != 0 || start.Second() != 0 || start.Nanosecond() != 0 {
+		return time.Time{}, &bookingError{fmt.Sprintf("start_time must be on a %d minute interval", d.slotMinutes)}
+	}
+	minutes := d.defaultDuration
+	if durationMinutes != nil {
+		minutes = *durationMinutes
+	}
+	if minutes <= 0 || minutes%d.slotMinutes != 0 {
+		return time.Time{}, &bookingError{fmt.Sprintf("duration_minutes must be a positive multiple of %d", d.slotMinutes)}
+	}
+	end := start.Add(time.Duration(minutes) * time.Minute)
+
+	if err := checkDoctorSchedule(ctx, tx, doctorID, start, end); err != nil {
+		return time.Time{}, err
+	}
+
+	booked, err := bookedIntervals(ctx, tx, doctorID, start, end, excludeID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if peakOverlap(booked, start, end, d.step()) >= d.capacity {
+		return time.Time{}, errSlotFull
+	}
+	return end, nil
+}
+
+// interval is a booked [start, end) span.
+type interval struct {
+	start, end time.Time
+}
+
+// bookedIntervals returns the doctor's active bookings overlapping [from, to),
+// ignoring excludeID.
+func bookedIntervals(ctx context.Context, q querier, doctorID string, from, to time.Time, excludeID string) ([]interval, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT start_time, end_time
+		FROM appointments
+		WHERE doctor_id = $1
+		  AND start_time < $3 AND end_time > $2
+		  AND `+activeStatusFilter+`
+		  AND id::text <> $4
+	`, doctorID, from, to, excludeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var booked []interval
+	for rows.Next() {
+		var iv interval
+		if err := rows.Scan(&iv.start, &iv.end); err != nil {
+			return nil, err
+		}
+		booked = append(booked, iv)
+	}
+	return booked, rows.Err()
+}
+
+// overlapping counts the intervals that overlap [from, to).
+func overlapping(booked []interval, from, to time.Time) int {
+	n := 0
+	for _, iv := range booked {
+		if iv.start.Before(to) && iv.end.After(from) {
+			n++
+		}
+	}
+	return n
+}
+
+// peakOverlap returns the highest number of bookings overlapping any step-long slot of
+// [start, end). A 30 minute booking on a 15 minute grid therefore occupies both quarters.
+func peakOverlap(booked []interval, start, end time.Time, step time.Duration) int {
+	peak := 0
+	for t := start; t.Before(end); t = t.Add(step) {
+		peak = max(peak, overlapping(booked, t, t.Add(step)))
+	}
+	return peak
+}
+
+// checkSessionCapacity returns errSessionFull if the session on date has no room left.
+// Session bookings have no row to lock, so it takes a transaction-scoped advisory lock
+// on (date, session) instead. excludeID skips the appointment being moved.
+func checkSessionCapacity(ctx context.Context, tx *sql.Tx, date, session, excludeID string) error {
+	_, err := tx.ExecContext(ctx, `
+		SELECT pg_advisory_xact_lock(hashtext('session:' || $1 || ':' || $2))
+	`, date, session)
+	if err != nil {
+		return err
+	}
+
+	capacity, booked, err := sessionUsage(ctx, tx, date, session, excludeID)
+	if err != nil {
+		return err
+	}
+	if booked >= capacity {
+		return errSessionFull
+	}
+	return nil
+}
+
+// sessionUsage returns the capacity of a session on date and how many active bookings
+// it holds, ignoring excludeID.
+func sessionUsage(ctx context.Context, q querier, date, session, excludeID string) (capacity, booked int, err error) {
+	err = q.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(
+				(SELECT capacity FROM session_capacity WHERE session_date = $1::date AND session = $2),
+				$3
+			),
+			(SELECT COUNT(*)
+			 FROM appointments
+			 WHERE session = $2
+			   AND appointment_date = $1::date
+			   AND `+activeStatusFilter+`
+			   AND id::text <> $4)
+	`, date, session, config.DefaultSessionCapacity(), excludeID).
+		Scan(&capacity, &booked)
+	return capacity, booked, err
+}
+
+// clinicDate is the clinic day (YYYY-MM-DD) containing t.
+func clinicDate(t time.Time) string {
+	return t.In(config.ClinicLocation()).Format(time.DateOnly)
+}
+
+// respondBookingError maps booking validation and capacity errors onto HTTP responses.
+func respondBookingError(c *gin.Context, err error) {
+	var be *bookingError
+	var pe *patientRuleError
+	var pol *policyError
+	switch {
+	case errors.As(err, &be):
+		c.JSON(http.StatusBadRequest, gin.H{"error": be.Error()})
+	case errors.As(err, &pe):
+		body := gin.H{"error": pe.Message, "code": pe.Code}
+		if pe.ConflictID != "" {
+			body["conflicting_appointment_id"] = pe.ConflictID
+		}
+		c.JSON(http.StatusConflict, body)
+	case errors.As(err, &pol):
+		respondPolicyError(c, pol)
+	case errors.Is(err, errSlotFull), errors.Is(err, errSessionFull):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateBooking(t *testing.T) {
+	str := func(s string) *string { return &s }
+	start := time.Now().Add(24 * time.Hour)
+	tomorrow := clinicDate(time.Now().AddDate(0, 0, 1))
+	yesterday := clinicDate(time.Now().AddDate(0, 0, -1))
+
+	tests := []struct {
+		name      string
+		doctorID  *string
+		startTime *time.Time
+		session   *string
+		date      *string
+		wantErr   bool
+	}{
+		{"session booking", nil, nil, str("morning"), &tomorrow, false},
+		{"doctor booking", str("d1"), &start, nil, nil, false},
+		{"session with doctor_id", str("d1"), nil, str("morning"), &tomorrow, true},
+		{"session and start_time", nil, &start, str("morning"), &tomorrow, true},
+		{"neither session nor start_time", str("d1"), nil, nil, nil, true},
+		{"unknown session", nil, nil, str("evening"), &tomorrow, true},
+		{"session without date", nil, nil, str("afternoon"), nil, true},
+		{"session with malformed date", nil, nil, str("afternoon"), str("tomorrow"), true},
+		{"session in the past", nil, nil, str("afternoon"), &yesterday, true},
+		{"start_time without doctor_id", nil, &start, nil, nil, true},
+		{"doctor booking with date", str("d1"), &start, nil, &tomorrow, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBooking(tt.doctorID, tt.startTime, tt.session, tt.date)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateBooking() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var be *bookingError
+			if err != nil && !errors.As(err, &be) {
+				t.Fatalf("validateBooking() error = %T, want *bookingError", err)
+			}
+		})
+	}
+}
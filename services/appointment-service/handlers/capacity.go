@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"appointment-service/models"
+	"github.com/gin-gonic/gin"
+)
+
+// SetSessionCapacity sets how many bookings a session takes on a given date,
+// overriding SESSION_CAPACITY_DEFAULT.
+func SetSessionCapacity(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.SessionCapacity
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := time.Parse(time.DateOnly, req.Date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+			return
+		}
+		if req.Session != "morning" && req.Session != "afternoon" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "session must be 'morning' or 'afternoon'"})
+			return
+		}
+
+		_, err := db.ExecContext(c.Request.Context(), `
+			INSERT INTO session_capacity (session_date, session, capacity)
+			VALUES ($1::date, $2, $3)
+			ON CONFLICT (session_date, session) DO UPDATE
+				SET capacity = EXCLUDED.capacity, updated_at = NOW()
+		`, req.Date, req.Session, req.Capacity)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, req)
+	}
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"appointment-service/config"
+	"appointment-service/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Codes returned when a check-in is refused.
+const (
+	codeCheckInNotOpen     = "check_in_not_open"
+	codeCheckInClosed      = "check_in_closed"
+	codeCheckInCodeInvalid = "check_in_code_invalid"
+	codeCheckInCodeExpired = "check_in_code_expired"
+	codeCheckInCodeUsed    = "check_in_code_used"
+)
+
+var (
+	errCheckInCodeInvalid = errors.New("invalid check-in code")
+	errCheckInCodeExpired = errors.New("check-in code has expired")
+	errCheckInCodeUsed    = errors.New("check-in code has already been used or the appointment has changed")
+)
+
+// checkInClaims is what a check-in code vouches for. The signature proves this service
+// issued it, and Version pins it to the appointment as it was then: checking in (or any
+// other change) bumps updated_at, so each code is redeemed at most once.
+type checkInClaims struct {
+	AppointmentID string `json:"a"`
+	PatientID     string `json:"p"`
+	Version       int64  `json:"v"` // updated_at in unix microseconds, as in the ETag
+	ExpiresAt     int64  `json:"e"` // unix seconds
+}
+
+// signCheckInCode encodes cl as base64url(payload) "." base64url(HMAC-SHA256).
+func signCheckInCode(secret string, cl checkInClaims) string {
+	b, _ := json.Marshal(cl)
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(checkInMAC(secret, payload))
+}
+
+func checkInMAC(secret, payload string) []byte {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte("check-in:" + payload))
+	return m.Sum(nil)
+}
+
+func verifyCheckInCode(secret, code string, now time.Time) (checkInClaims, error) {
+	var cl checkInClaims
+	payload, sig, ok := strings.Cut(code, ".")
+	if !ok {
+		return cl, errCheckInCodeInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, checkInMAC(secret, payload)) {
+		return cl, errCheckInCodeInvalid
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(b, &cl) != nil {
+		return cl, errCheckInCodeInvalid
+	}
+	if now.Unix() >= cl.ExpiresAt {
+		return cl, errCheckInCodeExpired
+	}
+	return cl, nil
+}
+
+// checkInCodeError reports whether the verified claims cl may check in a: they must name
+// it and its patient, and a must not have changed since the code was issued.
+func checkInCodeError(cl checkInClaims, a models.Appointment) error {
+	if cl.AppointmentID != a.ID || cl.PatientID != a.PatientID {
+		return errCheckInCodeInvalid
+	}
+	if cl.Version != a.UpdatedAt.UnixMicro() {
+		return errCheckInCodeUsed
+	}
+	return nil
+}
+
+// checkInWindow is when a may be checked in: from CHECK_IN_OPENS_BEFORE ahead of its start
+// until the no-show sweeper would take it (NO_SHOW_GRACE after the start, or after the end
+// of the session).
+func checkInWindow(a models.Appointment) (opens, closes time.Time) {
+	start := slotStart(a.StartTime, a.Session, a.Date)
+	end := start
+	if a.StartTime == nil {
+		_, end = sessionWindow(*a.Date, *a.Session)
+	}
+	return start.Add(-config.CheckInOpensBefore()), end.Add(config.NoShowGrace())
+}
+
+// checkInWindowError reports whether now falls outside a's check-in window.
+func checkInWindowError(a models.Appointment, now time.Time) error {
+	opens, closes := checkInWindow(a)
+	if now.Before(opens) {
+		return &policyError{codeCheckInNotOpen,
+			fmt.Sprintf("check-in opens %s before the appointment", formatPolicyDuration(config.CheckInOpensBefore())),
+			config.CheckInOpensBefore(), "opens_at", opens}
+	}
+	if !now.Before(closes) {
+		return &policyError{codeCheckInClosed,
+			"check-in for this appointment has closed",
+			config.NoShowGrace(), "closed_at", closes}
+	}
+	return nil
+}
+
+// checkInSecret returns CHECK_IN_SECRET, answering 503 if it is not configured.
+func checkInSecret(c *gin.Context) (string, bool) {
+	secret := config.CheckInSecret()
+	if secret == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "check-in codes are not configured"})
+		return "", false
+	}
+	return secret, true
+}
+
+// IssueCheckInCode gives the patient (or front-desk staff) a signed code for a scheduled appointment,
+// valid for CHECK_IN_CODE_TTL and for a single check-in. It is only issued while the
+// check-in window is open.
+func IssueCheckInCode(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret, ok := checkInSecret(c)
+		if !ok {
+			return
+		}
+		a, err := scanAppointment(db.QueryRowContext(c.Request.Context(), `
+			SELECT `+appointmentColumns+`
+			FROM appointments WHERE id = $1::uuid
+		`, c.Param("id")))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "appointment not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !canIssueCheckInCode(c, a.PatientID) {
+			c.JSON(http.StatusForbidden, errForbidden)
+			return
+		}
+		if a.Status != models.StatusScheduled {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":          "only scheduled appointments can be checked in",
+				"current_status": a.Status,
+			})
+			return
+		}
+		now := time.Now()
+		if err := checkInWindowError(a, now); err != nil {
+			respondBookingError(c, err)
+			return
+		}
+
+		expires := now.Add(config.CheckInCodeTTL()).Truncate(time.Second)
+		code := signCheckInCode(secret, checkInClaims{
+			AppointmentID: a.ID,
+			PatientID:     a.PatientID,
+			Version:       a.UpdatedAt.UnixMicro(),
+			ExpiresAt:     expires.Unix(),
+		})
+		c.JSON(http.StatusCreated, models.CheckInCode{AppointmentID: a.ID, Code: code, ExpiresAt: expires})
+	}
+}
+
+// CheckInAppointment is called by a front-desk kiosk with the code the patient presents,
+// proving they are at the clinic. Kiosk check-ins of doctor bookings later than
+// CHECK_IN_LATE_AFTER past the start are flagged late on the appointment and on the
+// appointment.checked_in event, so queue-coordinator can treat them as late arrivals.
+// Session bookings are a walk-in queue with no start of their own, so late stays null.
+func CheckInAppointment(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var req models.CheckInRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		secret, ok := checkInSecret(c)
+		if !ok {
+			return
+		}
+		now := time.Now()
+		claims, err := verifyCheckInCode(secret, req.Code, now)
+		if errors.Is(err, errCheckInCodeExpired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": codeCheckInCodeExpired})
+			return
+		}
+		if err != nil || claims.AppointmentID != id {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errCheckInCodeInvalid.Error(), "code": codeCheckInCodeInvalid})
+			return
+		}
+
+		ctx := c.Request.Context()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		current, err := scanAppointment(tx.QueryRowContext(ctx, `
+			SELECT `+appointmentColumns+`
+			FROM appointments WHERE id = $1::uuid
+			FOR UPDATE
+		`, id))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "appointment not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		switch err := checkInCodeError(claims, current); err {
+		case errCheckInCodeInvalid:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": codeCheckInCodeInvalid})
+			return
+		case errCheckInCodeUsed:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": codeCheckInCodeUsed})
+			return
+		}
+		var pe *preconditionError
+		if err := ifMatchError(c.GetHeader("If-Match"), current); errors.As(err, &pe) {
+			respondPreconditionFailed(c, pe)
+			return
+		}
+		if current.Status == models.StatusScheduled {
+			if err := checkInWindowError(current, now); err != nil {
+				respondBookingError(c, err)
+				return
+			}
+		}
+
+		// flag the arrival before the transition, so the event it enqueues carries it
+		var late *bool
+		reason := "kiosk check-in"
+		if current.StartTime != nil {
+			start := *current.StartTime
+			isLate := now.After(start.Add(config.CheckInLateAfter()))
+			late = &isLate
+			if isLate {
+				reason = fmt.Sprintf("kiosk check-in, %s after the start", formatPolicyDuration(now.Sub(start).Truncate(time.Minute)))
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE appointments SET checked_in_kiosk = TRUE, checked_in_late = $2 WHERE id = $1::uuid
+		`, id, late); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		a, err := transitionStatus(ctx, tx, id, models.StatusCheckedIn, actorID(c), &reason, nil)
+		if err != nil {
+			respondStatusError(c, err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		respondAppointment(c, http.StatusOK, a)
+	}
+}
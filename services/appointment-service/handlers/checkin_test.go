@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"appointment-service/models"
+)
+
+func TestCheckInCode(t *testing.T) {
+	const secret = "test-secret"
+	now := time.Unix(1_700_000_000, 0)
+	claims := checkInClaims{
+		AppointmentID: "6f1c2a5e-8d3b-4c7a-9e21-0b5d4f3a2c19",
+		PatientID:     "patient-1",
+		Version:       now.Add(-time.Hour).UnixMicro(),
+		ExpiresAt:     now.Add(5 * time.Minute).Unix(),
+	}
+	code := signCheckInCode(secret, claims)
+	payload, sig, _ := strings.Cut(code, ".")
+	forged, _, _ := strings.Cut(signCheckInCode(secret, checkInClaims{
+		AppointmentID: claims.AppointmentID, PatientID: "patient-2", Version: claims.Version, ExpiresAt: claims.ExpiresAt,
+	}), ".")
+
+	tests := []struct {
+		name    string
+		secret  string
+		code    string
+		now     time.Time
+		wantErr error
+	}{
+		{"round trip", secret, code, now, nil},
+		{"just before expiry", secret, code, now.Add(5*time.Minute - time.Second), nil},
+		{"at expiry", secret, code, now.Add(5 * time.Minute), errCheckInCodeExpired},
+		{"long expired", secret, code, now.Add(time.Hour), errCheckInCodeExpired},
+		{"other secret", "other-secret", code, now, errCheckInCodeInvalid},
+		{"tampered payload", secret, forged + "." + sig, now, errCheckInCodeInvalid},
+		{"tampered signature", secret, payload + "." + strings.Repeat("A", len(sig)), now, errCheckInCodeInvalid},
+		{"no signature", secret, payload, now, errCheckInCodeInvalid},
+		{"not base64", secret, "!!!." + sig, now, errCheckInCodeInvalid},
+		{"empty", secret, "", now, errCheckInCodeInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyCheckInCode(tt.secret, tt.code, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verifyCheckInCode() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got != claims {
+				t.Errorf("verifyCheckInCode() = %+v, want %+v", got, claims)
+			}
+		})
+	}
+}
+
+func TestCheckInCodeError(t *testing.T) {
+	issued := time.Date(2025, 3, 3, 8, 40, 0, 123456000, time.UTC)
+	a := models.Appointment{ID: "6f1c2a5e-8d3b-4c7a-9e21-0b5d4f3a2c19", PatientID: "patient-1", UpdatedAt: issued}
+	claims := checkInClaims{AppointmentID: a.ID, PatientID: a.PatientID, Version: issued.UnixMicro()}
+
+	checkedIn := a
+	checkedIn.UpdatedAt = issued.Add(3 * time.Minute)
+	otherPatient := a
+	otherPatient.PatientID = "patient-2"
+	otherAppointment := a
+	otherAppointment.ID = "0b5d4f3a-2c19-4c7a-9e21-6f1c2a5e8d3b"
+
+	tests := []struct {
+		name string
+		a    models.Appointment
+		want error
+	}{
+		{"unchanged since issue", a, nil},
+		{"replayed after check-in", checkedIn, errCheckInCodeUsed},
+		{"other patient", otherPatient, errCheckInCodeInvalid},
+		{"other appointment", otherAppointment, errCheckInCodeInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkInCodeError(claims, tt.a); err != tt.want {
+				t.Errorf("checkInCodeError() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
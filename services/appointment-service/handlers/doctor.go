@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"appointment-service/models"
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateDoctorSlotSettings changes a doctor's slot capacity, slot length and default
+// appointment duration. Existing bookings keep their times.
+func UpdateDoctorSlotSettings(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		doctorID := c.Param("doctor_id")
+		var req models.DoctorSlotSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx := c.Request.Context()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		var d models.Doctor
+		err = tx.QueryRowContext(ctx, `
+			UPDATE doctors
+			SET slot_capacity            = COALESCE($2, slot_capacity),
+			    slot_minutes             = COALESCE($3, slot_minutes),
+			    default_duration_minutes = COALESCE($4, default_duration_minutes)
+			WHERE id = $1
+			RETURNING id, name, specialization, slot_capacity, slot_minutes, default_duration_minutes
+		`, doctorID, req.SlotCapacity, req.SlotMinutes, req.DefaultDuration).
+			Scan(&d.ID, &d.Name, &d.Specialization, &d.SlotCapacity, &d.SlotMinutes, &d.DefaultDuration)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "doctor not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if d.DefaultDuration%d.SlotMinutes != 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(
+				"default_duration_minutes (%d) must be a multiple of slot_minutes (%d)", d.DefaultDuration, d.SlotMinutes)})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
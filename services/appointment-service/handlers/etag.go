@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+
+	"appointment-service/models"
+	"github.com/gin-gonic/gin"
+)
+
+// appointmentETag is the entity tag of one appointment, "<version>.<queue>". The version is
+// updated_at, which every change to the booking itself sets; the queue part fingerprints
+// queue_position and estimated_time, which queue snapshots refresh without touching
+// updated_at. If-None-Match compares the whole tag, so pollers see a new position, while
+// If-Match compares only the version, so a queue refresh never fails a staff write.
+func appointmentETag(a models.Appointment) string {
+	h := fnv.New32a()
+	if a.QueuePosition != nil {
+		fmt.Fprint(h, *a.QueuePosition)
+	}
+	h.Write([]byte{0})
+	if a.EstimatedTime != nil {
+		fmt.Fprint(h, a.EstimatedTime.UnixMicro())
+	}
+	return fmt.Sprintf(`"%d.%08x"`, a.UpdatedAt.UnixMicro(), h.Sum32())
+}
+
+// etagVersion is the version part of an appointment entity tag. Tags issued before the
+// queue part was added are all version.
+func etagVersion(tag string) string {
+	version, _, _ := strings.Cut(strings.Trim(tag, `"`), ".")
+	return version
+}
+
+// etagMatches reports whether header (an If-Match or If-None-Match list) names etag. With
+// weak set, W/ prefixes are ignored, as If-None-Match requires; If-Match compares strongly.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// preconditionError is returned when If-Match no longer names the current appointment.
+type preconditionError struct {
+	ETag string // current entity tag
+}
+
+func (e *preconditionError) Error() string {
+	return "appointment was modified since it was read; fetch it again and retry"
+}
+
+// checkIfMatch locks appointment id in tx and fails with *preconditionError if ifMatch is
+// set and does not name its current version. It returns sql.ErrNoRows for unknown IDs.
+func checkIfMatch(ctx context.Context, tx *sql.Tx, id, ifMatch string) error {
+	if ifMatch == "" {
+		return nil
+	}
+	var a models.Appointment
+	err := tx.QueryRowContext(ctx, `
+		SELECT updated_at, queue_position, estimated_time FROM appointments WHERE id = $1::uuid FOR UPDATE
+	`, id).Scan(&a.UpdatedAt, &a.QueuePosition, &a.EstimatedTime)
+	if err != nil {
+		return err
+	}
+	return ifMatchError(ifMatch, a)
+}
+
+// ifMatchError is checkIfMatch for a row the caller has already locked. Tags match on their
+// version alone, strongly, as If-Match requires.
+func ifMatchError(ifMatch string, a models.Appointment) error {
+	if ifMatch == "" {
+		return nil
+	}
+	etag := appointmentETag(a)
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || (!strings.HasPrefix(candidate, "W/") && etagVersion(candidate) == etagVersion(etag)) {
+			return nil
+		}
+	}
+	return &preconditionError{ETag: etag}
+}
+
+func respondPreconditionFailed(c *gin.Context, pe *preconditionError) {
+	c.Header("ETag", pe.ETag)
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": pe.Error()})
+}
+
+// respondAppointment writes a with its ETag, or 304 if the caller's If-None-Match already
+// names it.
+func respondAppointment(c *gin.Context, status int, a models.Appointment) {
+	etag := appointmentETag(a)
+	c.Header("ETag", etag)
+	if c.Request.Method == http.MethodGet && etagMatches(c.GetHeader("If-None-Match"), etag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(status, a)
+}
+
+// respondCacheable writes a GET response tagged with a hash of its body, answering 304 when
+// it is unchanged since the caller's If-None-Match. Pollers then skip the download.
+func respondCacheable(c *gin.Context, body any) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sum := sha256.Sum256(b)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", b)
+}
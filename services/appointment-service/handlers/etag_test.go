@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"appointment-service/models"
+)
+
+func TestIfMatchIgnoresQueueRefresh(t *testing.T) {
+	eta := time.Unix(1_700_000_000, 0)
+	read := models.Appointment{UpdatedAt: time.Unix(1_700_000_000, 123_000)}
+	tag := appointmentETag(read)
+
+	requeued := read
+	newPos := 1
+	requeued.QueuePosition, requeued.EstimatedTime = &newPos, &eta
+
+	edited := read
+	edited.UpdatedAt = read.UpdatedAt.Add(time.Millisecond)
+
+	legacy := `"` + etagVersion(tag) + `"` // issued before the queue part existed
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		current models.Appointment
+		wantErr bool
+	}{
+		{"unchanged", tag, read, false},
+		{"queue refreshed since the read", tag, requeued, false},
+		{"booking changed since the read", tag, edited, true},
+		{"one of a list", `"1", ` + tag, requeued, false},
+		{"any", "*", edited, false},
+		{"weak tags never match", "W/" + tag, read, true},
+		{"legacy tag", legacy, requeued, false},
+		{"no header", "", edited, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ifMatchError(tt.ifMatch, tt.current)
+			var pe *preconditionError
+			if got := errors.As(err, &pe); got != tt.wantErr {
+				t.Fatalf("ifMatchError() = %v, wantErr %v", err, tt.wantErr)
+			}
+			if pe != nil && pe.ETag != appointmentETag(tt.current) {
+				t.Errorf("412 carries ETag %s, want the current %s", pe.ETag, appointmentETag(tt.current))
+			}
+		})
+	}
+}
+
+func TestETagChangesWithQueue(t *testing.T) {
+	a := models.Appointment{UpdatedAt: time.Unix(1_700_000_000, 0)}
+	pos := 2
+	b := a
+	b.QueuePosition = &pos
+	if appointmentETag(a) == appointmentETag(b) {
+		t.Fatal("a new queue position must change the ETag, or If-None-Match pollers never see it")
+	}
+	if etagVersion(appointmentETag(a)) != etagVersion(appointmentETag(b)) {
+		t.Fatal("a queue refresh must not change the version part")
+	}
+}
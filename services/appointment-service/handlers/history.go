@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"appointment-service/models"
+	"github.com/gin-gonic/gin"
+)
+
+// recordEvent appends one row to appointment_events. It must be called with the same tx
+// as the mutation it describes so the audit trail can never disagree with the appointment.
+func recordEvent(ctx context.Context, tx *sql.Tx, appointmentID string, eventType models.EventType, actor string, oldValue, newValue any, reason *string) error {
+	return insertEvent(ctx, tx, &appointmentID, nil, eventType, actor, oldValue, newValue, reason)
+}
+
+// recordWaitlistEvent is recordEvent for waitlist entry entryID. appointmentID is set for a
+// promotion, so the row shows in the history of both the entry and the new appointment.
+func recordWaitlistEvent(ctx context.Context, tx *sql.Tx, entryID string, appointmentID *string, eventType models.EventType, actor string, oldValue, newValue any, reason *string) error {
+	return insertEvent(ctx, tx, appointmentID, &entryID, eventType, actor, oldValue, newValue, reason)
+}
+
+func insertEvent(ctx context.Context, tx *sql.Tx, appointmentID, entryID *string, eventType models.EventType, actor string, oldValue, newValue any, reason *string) error {
+	oldJSON, err := marshalEventValue(oldValue)
+	if err != nil {
+		return err
+	}
+	newJSON, err := marshalEventValue(newValue)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO appointment_events (appointment_id, waitlist_entry_id, event_type, actor_id, old_value, new_value, reason)
+		VALUES ($1::uuid, $2::uuid, $3, NULLIF($4, ''), $5::jsonb, $6::jsonb, $7)
+	`, appointmentID, entryID, eventType, actor, oldJSON, newJSON, reason)
+	return err
+}
+
+// marshalEventValue encodes v for a JSONB column, keeping nil as SQL NULL.
+func marshalEventValue(v any) (*string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	s := string(b)
+	return &s, nil
+}
+
+// statusSnapshot is the old/new value recorded for status changes and cancellations.
+type statusSnapshot struct {
+	Status     models.Status              `json:"status"`
+	ReasonCode *models.CancellationReason `json:"reason_code,omitempty"` // cancellations only
+}
+
+// bookingSnapshot is the old/new value recorded for bookings and reschedules.
+type bookingSnapshot struct {
+	Status    models.Status `json:"status"`
+	DoctorID  *string       `json:"doctor_id"`
+	StartTime *time.Time    `json:"start_time"`
+	EndTime   *time.Time    `json:"end_time"`
+	Session   *string       `json:"session"`
+	Date      *string       `json:"appointment_date"`
+}
+
+func snapshotBooking(a models.Appointment) bookingSnapshot {
+	return bookingSnapshot{Status: a.Status, DoctorID: a.DoctorID, StartTime: a.StartTime, EndTime: a.EndTime, Session: a.Session, Date: a.Date}
+}
+
+// waitlistSnapshot is the old/new value recorded when a patient joins or leaves the waitlist.
+type waitlistSnapshot struct {
+	Status      models.WaitlistStatus `json:"status"`
+	DoctorID    *string               `json:"doctor_id,omitempty"`
+	StartTime   *time.Time            `json:"start_time,omitempty"`
+	Session     *string               `json:"session,omitempty"`
+	SessionDate *string               `json:"session_date,omitempty"`
+}
+
+func snapshotWaitlist(w models.WaitlistEntry) waitlistSnapshot {
+	return waitlistSnapshot{Status: w.Status, DoctorID: w.DoctorID, StartTime: w.StartTime, Session: w.Session, SessionDate: w.SessionDate}
+}
+
+// actorID returns the authenticated user's ID as set by middleware.RequireAuth.
+func actorID(c *gin.Context) string {
+	return c.GetString("user_id")
+}
+
+func GetAppointmentHistory(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if !authorizeAppointment(c, db, id, func(patientID string, doctorID *string) bool {
+			return canAccess(c, patientID, doctorID)
+		}) {
+			return
+		}
+
+		respondHistory(c, db, "appointment_id", id)
+	}
+}
+
+// GetWaitlistHistory lists when a waitlist entry was joined, left or promoted.
+func GetWaitlistHistory(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("entry_id")
+
+		var patientID string
+		var doctorID *string
+		err := db.QueryRowContext(c.Request.Context(), `
+			SELECT patient_id, doctor_id FROM waitlist_entries WHERE id = $1::uuid
+		`, id).Scan(&patientID, &doctorID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "waitlist entry not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !canAccess(c, patientID, doctorID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to access this waitlist entry"})
+			return
+		}
+
+		respondHistory(c, db, "waitlist_entry_id", id)
+	}
+}
+
+// respondHistory writes the events whose column (appointment_id or waitlist_entry_id) is
+// id, oldest first.
+func respondHistory(c *gin.Context, db *sql.DB, column, id string) {
+	rows, err := db.QueryContext(c.Request.Context(), `
+		SELECT id, appointment_id::text, waitlist_entry_id::text, event_type, actor_id, old_value, new_value, reason, created_at
+		FROM appointment_events
+		WHERE `+column+` = $1::uuid
+		ORDER BY created_at ASC, id ASC
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	events := []models.AppointmentEvent{}
+	for rows.Next() {
+		var e models.AppointmentEvent
+		var oldValue, newValue []byte
+		if err := rows.Scan(
+			&e.ID, &e.AppointmentID, &e.WaitlistEntryID, &e.EventType, &e.ActorID,
+			&oldValue, &newValue, &e.Reason, &e.CreatedAt,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		e.OldValue = oldValue
+		e.NewValue = newValue
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	respondCacheable(c, events)
+}
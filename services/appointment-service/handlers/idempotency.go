@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"appointment-service/config"
+	"github.com/gin-gonic/gin"
+)
+
+const maxIdempotencyKeyLen = 255
+
+// errIdempotencyMismatch is returned when a key is reused with a different request body.
+var errIdempotencyMismatch = errors.New("Idempotency-Key was already used with a different request body")
+
+// storedResponse is the response saved under an Idempotency-Key.
+type storedResponse struct {
+	status int
+	body   []byte
+}
+
+// requestHash fingerprints the decoded request, so retries that only differ in whitespace
+// or field order still match.
+func requestHash(req any) (string, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// claimIdempotencyKey reserves key for actor in tx. If an unexpired earlier request already
+// committed under the key, it returns that request's response instead (or
+// errIdempotencyMismatch if the bodies differ) and the caller must not redo the work.
+// A concurrent request with the same key blocks on the insert until the first one commits
+// or rolls back. Failed requests roll back their claim, so only successes are replayed.
+func claimIdempotencyKey(ctx context.Context, tx *sql.Tx, key, actor, hash string) (*storedResponse, error) {
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE key = $1 AND actor_id = $2 AND expires_at <= NOW()
+	`, key, actor); err != nil {
+		return nil, err
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (key, actor_id, request_hash, expires_at)
+		VALUES ($1, $2, $3, NOW() + $4 * INTERVAL '1 second')
+		ON CONFLICT (key, actor_id) DO NOTHING
+	`, key, actor, hash, int64(config.IdempotencyKeyTTL().Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return nil, nil
+	}
+
+	var storedHash string
+	var stored storedResponse
+	err = tx.QueryRowContext(ctx, `
+		SELECT request_hash, status_code, response::text
+		FROM idempotency_keys
+		WHERE key = $1 AND actor_id = $2
+	`, key, actor).Scan(&storedHash, &stored.status, &stored.body)
+	if err != nil {
+		return nil, err
+	}
+	if storedHash != hash {
+		return nil, errIdempotencyMismatch
+	}
+	return &stored, nil
+}
+
+// saveIdempotentResponse stores the response for a key claimed in the same tx.
+func saveIdempotentResponse(ctx context.Context, tx *sql.Tx, key, actor string, status int, body any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = $3, response = $4::jsonb
+		WHERE key = $1 AND actor_id = $2
+	`, key, actor, status, string(b))
+	return err
+}
+
+// replayResponse writes a stored response back, marked so clients can tell it was replayed.
+func replayResponse(c *gin.Context, stored *storedResponse) {
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(stored.status, "application/json; charset=utf-8", stored.body)
+}
+
+// validIdempotencyKey writes a 400 and returns false if the header is present but unusable.
+func validIdempotencyKey(c *gin.Context, key string) bool {
+	if len(key) > maxIdempotencyKeyLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+		return false
+	}
+	return true
+}
+
+// RunIdempotencyPruner deletes expired Idempotency-Key records every interval until ctx is
+// done. Expired keys are also replaced lazily when reused, so this only bounds table size.
+func RunIdempotencyPruner(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`); err != nil && ctx.Err() == nil {
+			log.Printf("pruning idempotency keys: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
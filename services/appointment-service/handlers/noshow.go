@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"appointment-service/config"
+	"appointment-service/models"
+)
+
+const noShowBatchSize = 100
+
+// RunNoShowSweeper marks scheduled appointments no_show once their start (or, for session
+// bookings, the session's end) is more than grace in the past, every interval until ctx is
+// done. Each one goes through transitionStatus, so it is recorded in history, published as
+// appointment.no_show and frees its capacity for the waitlist.
+func RunNoShowSweeper(ctx context.Context, db *sql.DB, interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := sweepNoShows(ctx, db, grace)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("no-show sweep: %v", err)
+				}
+				break
+			}
+			if n > 0 {
+				log.Printf("no-show sweep: marked %d appointment(s) no_show", n)
+			}
+			if n < noShowBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweepNoShows marks one batch of overdue appointments no_show and returns how many.
+// Rows are claimed with SKIP LOCKED, so replicas sweeping at the same time split the work
+// instead of blocking on each other, and a row a user is changing right now is left for the
+// next round.
+func sweepNoShows(ctx context.Context, db *sql.DB, grace time.Duration) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id::text
+		FROM appointments
+		WHERE status = $1
+		  AND COALESCE(
+		        start_time,
+		        (appointment_date + make_interval(mins => CASE session WHEN 'morning' THEN $2 ELSE $3 END))
+		            AT TIME ZONE $4
+		      ) < NOW() - $5 * INTERVAL '1 second'
+		ORDER BY id
+		LIMIT $6
+		FOR UPDATE SKIP LOCKED
+	`, models.StatusScheduled, sessionHours["morning"].end, sessionHours["afternoon"].end,
+		config.ClinicLocation().String(), int64(grace.Seconds()), noShowBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	reason := "no check-in within the " + grace.String() + " grace period"
+	for _, id := range ids {
+		if _, err := transitionStatus(ctx, tx, id, models.StatusNoShow, "", &reason, nil); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
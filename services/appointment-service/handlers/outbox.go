@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"appointment-service/models"
+)
+
+// Routing keys published on clinic.events for appointment changes.
+const (
+	routingBooked      = "appointment.booked"
+	routingCancelled   = "appointment.cancelled"
+	routingRescheduled = "appointment.rescheduled"
+)
+
+// statusRoutingKeys maps status transitions to the event they publish. Transitions not
+// listed (e.g. in_progress) are recorded in history only.
+var statusRoutingKeys = map[models.Status]string{
+	models.StatusCheckedIn: "appointment.checked_in",
+	models.StatusCompleted: "appointment.completed",
+	models.StatusNoShow:    "appointment.no_show",
+	models.StatusCancelled: routingCancelled,
+}
+
+// appointmentMessage is the body of every appointment.* event. The first five fields match
+// what the composite used to publish for appointment.booked, so existing consumers keep
+// working.
+type appointmentMessage struct {
+	AppointmentID string                     `json:"appointment_id"`
+	PatientID     string                     `json:"patient_id"`
+	DoctorID      *string                    `json:"doctor_id"`
+	StartTime     *time.Time                 `json:"start_time"`
+	Session       *string                    `json:"session"`
+	Date          *string                    `json:"appointment_date"`
+	EndTime       *time.Time                 `json:"end_time"`
+	Status        models.Status              `json:"status"`
+	Reason        *string                    `json:"reason,omitempty"`
+	ReasonCode    *models.CancellationReason `json:"reason_code,omitempty"` // cancelled only
+	Kiosk         bool                       `json:"kiosk,omitempty"`       // checked_in from a kiosk only
+	Late          *bool                      `json:"late,omitempty"`        // kiosk check-ins of doctor bookings only
+	Previous      *bookingSnapshot           `json:"previous,omitempty"`    // rescheduled only
+	OccurredAt    time.Time                  `json:"occurred_at"`
+}
+
+// enqueueEvent writes an appointment event to the outbox in tx. The relay publishes it
+// after commit, so the event exists if and only if the change it describes does.
+func enqueueEvent(ctx context.Context, tx *sql.Tx, routingKey string, a models.Appointment, reason *string, previous *bookingSnapshot) error {
+	var kiosk bool
+	var late *bool
+	if routingKey == statusRoutingKeys[models.StatusCheckedIn] {
+		kiosk, late = a.CheckedInKiosk, a.CheckedInLate
+	}
+	body, err := json.Marshal(appointmentMessage{
+		AppointmentID: a.ID,
+		PatientID:     a.PatientID,
+		DoctorID:      a.DoctorID,
+		StartTime:     a.StartTime,
+		Session:       a.Session,
+		Date:          a.Date,
+		EndTime:       a.EndTime,
+		Status:        a.Status,
+		Reason:        reason,
+		ReasonCode:    a.CancellationReason,
+		Kiosk:         kiosk,
+		Late:          late,
+		Previous:      previous,
+		OccurredAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO outbox (aggregate_id, routing_key, payload)
+		VALUES ($1::uuid, $2, $3::jsonb)
+	`, a.ID, routingKey, string(body))
+	return err
+}
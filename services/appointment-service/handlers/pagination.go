@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"appointment-service/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// appointmentDateSQL is an appointment's clinic day: appointment_date for session
+// bookings, the start_time date for doctor bookings. tz is the clinic time zone parameter
+// of the query it is used in.
+func appointmentDateSQL(tz string) string {
+	return `COALESCE(appointment_date, (start_time AT TIME ZONE ` + tz + `)::date)`
+}
+
+// sortKeys are the sort= values GET /appointments accepts, with the column each orders by.
+// Session bookings have no start_time and sort by the start of their session; $7 is the
+// clinic time zone parameter of the list query.
+var sortKeys = map[string]string{
+	"created_at": "created_at",
+	"start_time": fmt.Sprintf(`COALESCE(start_time,
+		(appointment_date + make_interval(mins => CASE session WHEN 'morning' THEN %d ELSE %d END)) AT TIME ZONE $7,
+		created_at)`, sessionHours["morning"].start, sessionHours["afternoon"].start),
+}
+
+// listParams are the validated query parameters of GET /appointments.
+type listParams struct {
+	statuses      []string
+	cancelReasons []string
+	cancelledBy   string
+	session       string
+	from, to      string // clinic dates, inclusive
+	sort          string
+	desc          bool
+	limit         int
+	after         *pageCursor
+	paged         bool // limit or cursor was given, so the response is an AppointmentPage
+}
+
+// pageCursor is the position after the last row of a page. It is handed to clients as
+// opaque base64 and records the ordering it belongs to, so it can't be replayed against a
+// different one.
+type pageCursor struct {
+	Sort string    `json:"s"`
+	Desc bool      `json:"d"`
+	Key  time.Time `json:"k"`
+	ID   string    `json:"i"`
+}
+
+func (p pageCursor) encode() string {
+	b, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var p pageCursor
+	if err := json.Unmarshal(b, &p); err != nil || p.ID == "" || !uuidPattern.MatchString(p.ID) {
+		return nil, errors.New("invalid cursor")
+	}
+	return &p, nil
+}
+
+// parseListParams reads the paging, sorting and filter parameters of GET /appointments.
+// status and cancellation_reason may be repeated or comma-separated; date is shorthand for
+// from=to=date.
+func parseListParams(c *gin.Context) (listParams, error) {
+	p := listParams{
+		sort:        c.DefaultQuery("sort", "created_at"),
+		session:     c.Query("session"),
+		cancelledBy: c.Query("cancelled_by"),
+		from:        c.Query("from"),
+		to:          c.Query("to"),
+		limit:       defaultPageSize,
+	}
+
+	var err error
+	p.statuses, err = queryList(c, "status", func(s string) bool { return models.Status(s).Valid() })
+	if err != nil {
+		return p, err
+	}
+	p.cancelReasons, err = queryList(c, "cancellation_reason", func(s string) bool {
+		return models.CancellationReason(s).Valid()
+	})
+	if err != nil {
+		return p, err
+	}
+	if p.session != "" && p.session != "morning" && p.session != "afternoon" {
+		return p, errors.New("session must be 'morning' or 'afternoon'")
+	}
+
+	if date := c.Query("date"); date != "" {
+		if p.from != "" || p.to != "" {
+			return p, errors.New("use either date or from/to, not both")
+		}
+		p.from, p.to = date, date
+	}
+	for _, d := range []string{p.from, p.to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, d); err != nil {
+			return p, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", d)
+		}
+	}
+	if p.from != "" && p.to != "" && p.to < p.from {
+		return p, errors.New("to must not be before from")
+	}
+
+	if _, ok := sortKeys[p.sort]; !ok {
+		return p, errors.New("sort must be 'created_at' or 'start_time'")
+	}
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		p.desc = true
+	default:
+		return p, errors.New("order must be 'asc' or 'desc'")
+	}
+
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return p, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		p.limit = n
+		p.paged = true
+	}
+	if v := c.Query("cursor"); v != "" {
+		cur, err := decodeCursor(v)
+		if err != nil {
+			return p, err
+		}
+		if cur.Sort != p.sort || cur.Desc != p.desc {
+			return p, errors.New("cursor was issued for a different sort order")
+		}
+		p.after = cur
+		p.paged = true
+	}
+	return p, nil
+}
+
+// queryList collects a multi-valued query parameter, given repeated or comma-separated,
+// and checks each value with valid.
+func queryList(c *gin.Context, name string, valid func(string) bool) ([]string, error) {
+	var values []string
+	for _, v := range c.QueryArray(name) {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			if !valid(s) {
+				return nil, fmt.Errorf("invalid %s %q", name, s)
+			}
+			values = append(values, s)
+		}
+	}
+	return values, nil
+}
+
+// sortKey is the value of the sort column for a, matching sortKeys.
+func (p listParams) sortKey(a models.Appointment) time.Time {
+	if p.sort == "start_time" {
+		switch {
+		case a.StartTime != nil:
+			return *a.StartTime
+		case a.Date != nil && a.Session != nil:
+			start, _ := sessionWindow(*a.Date, *a.Session)
+			return start
+		}
+	}
+	return a.CreatedAt
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"appointment-service/middleware"
+)
+
+func TestParseListParamsPaging(t *testing.T) {
+	cursor := pageCursor{Sort: "created_at", Key: time.Unix(1_700_000_000, 0), ID: "6f1c2a5e-8d3b-4c7a-9e21-0b5d4f3a2c19"}.encode()
+	tests := []struct {
+		name      string
+		query     string
+		wantPaged bool
+		wantLimit int
+		wantErr   bool
+	}{
+		{"no paging is a plain list", "?patient_id=pat-1", false, defaultPageSize, false},
+		{"limit opts in", "?limit=20", true, 20, false},
+		{"cursor opts in", "?cursor=" + cursor, true, defaultPageSize, false},
+		{"limit too large", "?limit=500", false, 0, true},
+		{"cursor for another sort", "?sort=start_time&cursor=" + cursor, false, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testContext(middleware.RoleStaff, "staff-1")
+			c.Request = httptest.NewRequest(http.MethodGet, "/appointments"+tt.query, nil)
+			p, err := parseListParams(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseListParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if p.paged != tt.wantPaged || p.limit != tt.wantLimit {
+				t.Errorf("paged, limit = %v, %d; want %v, %d", p.paged, p.limit, tt.wantPaged, tt.wantLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"appointment-service/config"
+)
+
+// Codes returned with 409 when a booking breaks a patient-level rule.
+const (
+	codePatientOverlap       = "patient_overlap"
+	codePatientSessionPerDay = "patient_session_per_day"
+	codePatientBookingLimit  = "patient_booking_limit"
+)
+
+// patientRuleError is a booking rejected by a patient-level rule. ConflictID is the
+// existing appointment it clashes with, if any.
+type patientRuleError struct {
+	Code       string
+	Message    string
+	ConflictID string
+}
+
+func (e *patientRuleError) Error() string { return e.Message }
+
+// sessionWindow is the clinic-time span of session on date (YYYY-MM-DD).
+func sessionWindow(date, session string) (start, end time.Time) {
+	day, _ := time.ParseInLocation(time.DateOnly, date, config.ClinicLocation())
+	h := sessionHours[session]
+	return day.Add(time.Duration(h.start) * time.Minute), day.Add(time.Duration(h.end) * time.Minute)
+}
+
+// checkPatientBooking runs checkPatientRules for a booking given as either start/end or
+// session/date.
+func checkPatientBooking(ctx context.Context, tx *sql.Tx, patientID string, start, end *time.Time, session, date *string, excludeID string) error {
+	if session != nil {
+		from, to := sessionWindow(*date, *session)
+		return checkPatientRules(ctx, tx, patientID, from, to, *date, excludeID)
+	}
+	return checkPatientRules(ctx, tx, patientID, *start, *end, "", excludeID)
+}
+
+// checkPatientRules applies the patient-level booking rules to a new booking of patientID
+// spanning start–end (a session booking passes its window and its date as sessionDate).
+// It takes a transaction-scoped advisory lock on the patient, so concurrent bookings for
+// the same patient are checked one after another. Call it after the doctor or session
+// capacity checks to keep lock order consistent. excludeID skips the appointment being
+// moved.
+func checkPatientRules(ctx context.Context, tx *sql.Tx, patientID string, start, end time.Time, sessionDate, excludeID string) error {
+	overlap := config.PatientPreventOverlap()
+	sessionPerDay := config.PatientOneSessionPerDay()
+	limit := config.PatientMaxActiveBookings()
+	if !overlap && !sessionPerDay && limit <= 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		SELECT pg_advisory_xact_lock(hashtext('patient:' || $1))
+	`, patientID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id::text, start_time, end_time, session, to_char(appointment_date, 'YYYY-MM-DD')
+		FROM appointments
+		WHERE patient_id = $1
+		  AND `+activeStatusFilter+`
+		  AND id::text <> $2
+		  AND `+appointmentDateSQL("$3")+` >= $4::date
+		ORDER BY id
+	`, patientID, excludeID, config.ClinicLocation().String(), clinicDate(now))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	upcoming := 0
+	for rows.Next() {
+		var id string
+		var otherStart, otherEnd *time.Time
+		var session, date *string
+		if err := rows.Scan(&id, &otherStart, &otherEnd, &session, &date); err != nil {
+			return err
+		}
+		var from, to time.Time
+		if otherStart != nil && otherEnd != nil {
+			from, to = *otherStart, *otherEnd
+		} else if session != nil && date != nil {
+			from, to = sessionWindow(*date, *session)
+		}
+
+		if sessionPerDay && sessionDate != "" && session != nil && date != nil && *date == sessionDate {
+			return &patientRuleError{codePatientSessionPerDay,
+				"patient already has a session booking on " + sessionDate, id}
+		}
+		if overlap && from.Before(end) && to.After(start) {
+			return &patientRuleError{codePatientOverlap,
+				"patient already has an appointment at an overlapping time", id}
+		}
+		if to.After(now) {
+			upcoming++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if limit > 0 && upcoming >= limit {
+		return &patientRuleError{codePatientBookingLimit,
+			fmt.Sprintf("patient already has %d upcoming bookings, the most allowed", upcoming), ""}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"appointment-service/config"
+	"appointment-service/middleware"
+	"appointment-service/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Codes returned with 422 when a booking policy refuses a request.
+const (
+	codeLeadTime     = "booking_lead_time"
+	codeHorizon      = "booking_horizon"
+	codeCancelCutoff = "cancellation_cutoff"
+)
+
+// policyError is a request refused by the caller's config.BookingPolicy. Boundary is the
+// moment the limit falls on and is reported under Field, so clients can show e.g. the
+// earliest start they may pick.
+type policyError struct {
+	Code     string
+	Message  string
+	Limit    time.Duration
+	Field    string
+	Boundary time.Time
+}
+
+func (e *policyError) Error() string { return e.Message }
+
+func respondPolicyError(c *gin.Context, e *policyError) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error": e.Message,
+		"code":  e.Code,
+		"limit": e.Limit.String(),
+		e.Field: e.Boundary,
+	})
+}
+
+// slotStart is when a booking begins: its start_time, or the start of its session.
+func slotStart(start *time.Time, session, date *string) time.Time {
+	if start != nil {
+		return *start
+	}
+	from, _ := sessionWindow(*date, *session)
+	return from
+}
+
+// checkBookingPolicy applies role's lead time and horizon to a new or moved booking.
+// Session bookings are walk-in queues, so they have no lead time; validateSessionDate
+// already keeps them out of sessions that have ended.
+func checkBookingPolicy(role string, start *time.Time, session, date *string) error {
+	p := config.BookingPolicyFor(role)
+	now := time.Now()
+	begin := slotStart(start, session, date)
+
+	if session == nil {
+		if earliest := now.Add(p.MinLeadTime); begin.Before(earliest) {
+			msg := "appointments can't start in the past"
+			if p.MinLeadTime > 0 {
+				msg = fmt.Sprintf("appointments must be booked at least %s ahead", formatPolicyDuration(p.MinLeadTime))
+			}
+			return &policyError{codeLeadTime, msg, p.MinLeadTime, "earliest_start", earliest}
+		}
+	}
+	if p.MaxHorizon > 0 {
+		if latest := now.Add(p.MaxHorizon); begin.After(latest) {
+			return &policyError{codeHorizon,
+				fmt.Sprintf("appointments can be booked at most %s ahead", formatPolicyDuration(p.MaxHorizon)),
+				p.MaxHorizon, "latest_start", latest}
+		}
+	}
+	return nil
+}
+
+// checkCancelCutoff refuses cancelling or moving a, under role's policy, once its start is
+// closer than the cancellation cutoff. A booking made within the role's undo window can
+// still be undone, e.g. by the composite when claiming the doctor's slot fails.
+func checkCancelCutoff(role string, a models.Appointment) error {
+	p := config.BookingPolicyFor(role)
+	if p.CancelCutoff <= 0 || a.Status != models.StatusScheduled || time.Since(a.CreatedAt) < p.UndoWindow {
+		return nil
+	}
+	cutoff := slotStart(a.StartTime, a.Session, a.Date).Add(-p.CancelCutoff)
+	if time.Now().After(cutoff) {
+		return &policyError{codeCancelCutoff,
+			fmt.Sprintf("appointments can't be cancelled or moved less than %s before they start", formatPolicyDuration(p.CancelCutoff)),
+			p.CancelCutoff, "cutoff_at", cutoff}
+	}
+	return nil
+}
+
+// cancellationAllowed applies checkCancelCutoff to appointment id for the caller, writing
+// the response itself and returning false if the cancel must stop.
+func cancellationAllowed(c *gin.Context, db *sql.DB, id string) bool {
+	if config.BookingPolicyFor(middleware.Role(c)).CancelCutoff <= 0 {
+		return true
+	}
+	a, err := scanAppointment(db.QueryRowContext(c.Request.Context(), `
+		SELECT `+appointmentColumns+` FROM appointments WHERE id = $1::uuid
+	`, id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "appointment not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := checkCancelCutoff(middleware.Role(c), a); err != nil {
+		respondBookingError(c, err)
+		return false
+	}
+	return true
+}
+
+// formatPolicyDuration renders whole hours and days the way people write them.
+func formatPolicyDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return plural(int(d/(24*time.Hour)), "day")
+	case d >= time.Hour && d%time.Hour == 0:
+		return plural(int(d/time.Hour), "hour")
+	case d%time.Minute == 0:
+		return plural(int(d/time.Minute), "minute")
+	}
+	return d.String()
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
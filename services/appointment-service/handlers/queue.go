@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"appointment-service/config"
+	"appointment-service/models"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ApplyQueueSnapshot replaces the queue positions and estimated times of one doctor's or
+// session's queue on a day. The snapshot is the whole queue: active appointments of that
+// queue missing from it have both fields cleared. Snapshots carry a version per queue and
+// anything not newer than the last applied one is rejected, so a delayed retry can never
+// overwrite a fresher ordering.
+func ApplyQueueSnapshot(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.QueueSnapshotRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if (req.DoctorID == nil) == (req.Session == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "provide exactly one of doctor_id or session"})
+			return
+		}
+		if req.Session != nil && *req.Session != "morning" && *req.Session != "afternoon" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "session must be 'morning' or 'afternoon'"})
+			return
+		}
+		if _, err := time.Parse(time.DateOnly, req.Date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+			return
+		}
+
+		ids := make([]string, len(req.Entries))
+		seenID := map[string]bool{}
+		seenPos := map[int]bool{}
+		for i := range req.Entries {
+			e := &req.Entries[i]
+			if e.QueuePosition == nil {
+				pos := i + 1
+				e.QueuePosition = &pos
+			}
+			if *e.QueuePosition < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "queue_position must be at least 1"})
+				return
+			}
+			if seenID[e.AppointmentID] || seenPos[*e.QueuePosition] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("duplicate appointment or position at entry %d", i)})
+				return
+			}
+			seenID[e.AppointmentID] = true
+			seenPos[*e.QueuePosition] = true
+			ids[i] = e.AppointmentID
+		}
+
+		// the queue an appointment belongs to, as a filter on appointments
+		var queueKey string
+		var scopeFilter string
+		var scopeArg string
+		if req.DoctorID != nil {
+			queueKey = "doctor:" + *req.DoctorID + ":" + req.Date
+			scopeFilter = `doctor_id = $1 AND ` + appointmentDateSQL("$3") + ` = $2::date`
+			scopeArg = *req.DoctorID
+		} else {
+			queueKey = "session:" + *req.Session + ":" + req.Date
+			scopeFilter = `session = $1 AND doctor_id IS NULL AND ` + appointmentDateSQL("$3") + ` = $2::date`
+			scopeArg = *req.Session
+		}
+		tz := config.ClinicLocation().String()
+
+		ctx := c.Request.Context()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		// claim the version; the row lock serialises concurrent snapshots of the same queue
+		var applied int64
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO queue_snapshot_versions (queue_key, version)
+			VALUES ($1, $2)
+			ON CONFLICT (queue_key) DO UPDATE
+				SET version = EXCLUDED.version, updated_at = NOW()
+				WHERE queue_snapshot_versions.version < EXCLUDED.version
+			RETURNING version
+		`, queueKey, req.Version).Scan(&applied)
+		if err == sql.ErrNoRows {
+			var current int64
+			if err := tx.QueryRowContext(ctx, `
+				SELECT version FROM queue_snapshot_versions WHERE queue_key = $1
+			`, queueKey).Scan(&current); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusConflict, gin.H{"error": "stale queue snapshot", "current_version": current})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// lock the queue's active appointments and check every entry belongs to it
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id::text FROM appointments
+			WHERE `+scopeFilter+` AND `+activeStatusFilter+`
+			FOR UPDATE
+		`, scopeArg, req.Date, tz)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		inQueue := map[string]bool{}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			inQueue[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var foreign []string
+		for _, id := range ids {
+			if !inQueue[id] {
+				foreign = append(foreign, id)
+			}
+		}
+		if len(foreign) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":           "appointments are not active in this queue",
+				"appointment_ids": foreign,
+			})
+			return
+		}
+
+		changed := []models.Appointment{}
+		for _, e := range req.Entries {
+			a, err := scanAppointment(tx.QueryRowContext(ctx, `
+				UPDATE appointments
+				SET queue_position = $1, estimated_time = $2
+				WHERE id = $3::uuid
+				  AND (queue_position IS DISTINCT FROM $1 OR estimated_time IS DISTINCT FROM $2)
+				RETURNING `+appointmentColumns,
+				*e.QueuePosition, e.EstimatedTime, e.AppointmentID))
+			if err == sql.ErrNoRows {
+				continue // unchanged
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			changed = append(changed, a)
+		}
+
+		// anyone left in the queue but missing from the snapshot has been taken off it
+		dropped, err := tx.QueryContext(ctx, `
+			UPDATE appointments
+			SET queue_position = NULL, estimated_time = NULL
+			WHERE `+scopeFilter+` AND `+activeStatusFilter+`
+			  AND id::text <> ALL($4::text[])
+			  AND (queue_position IS NOT NULL OR estimated_time IS NOT NULL)
+			RETURNING `+appointmentColumns,
+			scopeArg, req.Date, tz, pq.Array(ids))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for dropped.Next() {
+			a, err := scanAppointment(dropped)
+			if err != nil {
+				dropped.Close()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			changed = append(changed, a)
+		}
+		dropped.Close()
+		if err := dropped.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, models.QueueSnapshotResult{Version: applied, Changed: changed})
+	}
+}
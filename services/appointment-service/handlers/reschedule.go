@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"appointment-service/middleware"
+	"appointment-service/models"
+	"github.com/gin-gonic/gin"
+)
+
+// RescheduleAppointment moves a scheduled appointment to a new slot in place, so the
+// appointment ID referenced by queue-coordinator and payments stays the same.
+func RescheduleAppointment(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var req models.RescheduleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx := c.Request.Context()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		current, err := scanAppointment(tx.QueryRowContext(ctx, `
+			SELECT `+appointmentColumns+`
+			FROM appointments WHERE id = $1::uuid
+			FOR UPDATE
+		`, id))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "appointment not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !canModify(c, current.PatientID, current.DoctorID) {
+			c.JSON(http.StatusForbidden, errForbidden)
+			return
+		}
+		var pe *preconditionError
+		if errors.As(ifMatchError(c.GetHeader("If-Match"), current), &pe) {
+			respondPreconditionFailed(c, pe)
+			return
+		}
+		// once the patient has checked in the slot is being used; only untouched bookings move
+		if current.Status != models.StatusScheduled {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":          "only scheduled appointments can be rescheduled",
+				"current_status": current.Status,
+			})
+			return
+		}
+
+		doctorID := req.DoctorID
+		if doctorID == nil && req.StartTime != nil {
+			doctorID = current.DoctorID
+		}
+		date := req.Date
+		if date == nil && req.Session != nil {
+			date = current.Date
+		}
+		if err := validateBooking(doctorID, req.StartTime, req.Session, date); err != nil {
+			respondBookingError(c, err)
+			return
+		}
+		// moving a booking gives up its slot, so it is held to the cancellation cutoff too
+		if err := checkCancelCutoff(middleware.Role(c), current); err != nil {
+			respondBookingError(c, err)
+			return
+		}
+		if err := checkBookingPolicy(middleware.Role(c), req.StartTime, req.Session, date); err != nil {
+			respondBookingError(c, err)
+			return
+		}
+		if req.Session != nil {
+			doctorID = nil
+		}
+		if sameSlot(current, doctorID, req.StartTime, req.Session, date) && (req.Duration == nil || sameDuration(current, *req.Duration)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "appointment is already booked in that slot"})
+			return
+		}
+
+		var endTime *time.Time
+		if doctorID != nil {
+			duration := req.Duration
+			if duration == nil {
+				duration = current.Duration
+			}
+			var end time.Time
+			end, err = checkDoctorBooking(ctx, tx, *doctorID, *req.StartTime, duration, current.ID)
+			endTime = &end
+		} else {
+			err = checkSessionSchedule(ctx, tx, *date)
+			if err == nil {
+				err = checkSessionCapacity(ctx, tx, *date, *req.Session, current.ID)
+			}
+		}
+		if err == nil {
+			err = checkPatientBooking(ctx, tx, current.PatientID, req.StartTime, endTime, req.Session, date, current.ID)
+		}
+		if err != nil {
+			respondBookingError(c, err)
+			return
+		}
+
+		// the queue position and ETA belonged to the old slot
+		a, err := scanAppointment(tx.QueryRowContext(ctx, `
+			UPDATE appointments
+			SET doctor_id = $1, start_time = $2, end_time = $3, session = $4, appointment_date = $5::date,
+				estimated_time = NULL, queue_position = NULL, updated_at = NOW()
+			WHERE id = $6::uuid
+			RETURNING `+appointmentColumns,
+			doctorID, req.StartTime, endTime, req.Session, date, id))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		err = recordEvent(ctx, tx, a.ID, models.EventRescheduled, actorID(c),
+			snapshotBooking(current), snapshotBooking(a), req.Reason)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		previous := snapshotBooking(current)
+		if err := enqueueEvent(ctx, tx, routingRescheduled, a, req.Reason, &previous); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := promoteWaitlist(ctx, tx, current); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		respondAppointment(c, http.StatusOK, a)
+	}
+}
+
+func sameSlot(a models.Appointment, doctorID *string, startTime *time.Time, session, date *string) bool {
+	if session != nil {
+		return a.Session != nil && *a.Session == *session && *a.Date == *date
+	}
+	return a.DoctorID != nil && *a.DoctorID == *doctorID &&
+		a.StartTime != nil && a.StartTime.Equal(*startTime)
+}
+
+func sameDuration(a models.Appointment, minutes int) bool {
+	return a.Duration != nil && *a.Duration == minutes
+}
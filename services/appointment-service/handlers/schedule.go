@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"appointment-service/config"
+	"appointment-service/models"
+	"github.com/gin-gonic/gin"
+)
+
+// window is a span of clinic time in minutes since midnight, end exclusive.
+type window struct {
+	start, end int
+}
+
+// defaultWorkingDays are the weekdays a doctor with no configured hours works, and the days
+// session bookings are accepted on.
+var defaultWorkingDays = map[time.Weekday]bool{
+	time.Monday: true, time.Tuesday: true, time.Wednesday: true,
+	time.Thursday: true, time.Friday: true, time.Saturday: true,
+}
+
+// minuteOfDay returns t's clinic-time offset from midnight in minutes.
+func minuteOfDay(t time.Time) int {
+	t = t.In(config.ClinicLocation())
+	return t.Hour()*60 + t.Minute()
+}
+
+// parseClock parses "HH:MM" into minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// clinicClosure reports whether the clinic is closed on day, and why.
+func clinicClosure(ctx context.Context, q querier, day time.Time) (reason string, closed bool, err error) {
+	day = day.In(config.ClinicLocation())
+	if !defaultWorkingDays[day.Weekday()] {
+		return fmt.Sprintf("clinic is closed on %ss", day.Weekday()), true, nil
+	}
+	var r sql.NullString
+	err = q.QueryRowContext(ctx, `
+		SELECT reason FROM clinic_closures WHERE closure_date = $1::date
+	`, day.Format(time.DateOnly)).Scan(&r)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	reason = "clinic is closed on " + day.Format(time.DateOnly)
+	if r.Valid && r.String != "" {
+		reason += " (" + r.String + ")"
+	}
+	return reason, true, nil
+}
+
+// workingWindows returns the doctor's working windows on day. Doctors without any
+// configured hours work the session windows on defaultWorkingDays.
+func workingWindows(ctx context.Context, q querier, doctorID string, day time.Time) ([]window, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT weekday, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+		FROM doctor_working_hours
+		WHERE doctor_id = $1
+		ORDER BY start_time
+	`, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	weekday := int(day.In(config.ClinicLocation()).Weekday())
+	configured := false
+	var windows []window
+	for rows.Next() {
+		var wd int
+		var start, end string
+		if err := rows.Scan(&wd, &start, &end); err != nil {
+			return nil, err
+		}
+		configured = true
+		if wd != weekday {
+			continue
+		}
+		s, _ := parseClock(start)
+		e, _ := parseClock(end)
+		windows = append(windows, window{s, e})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !configured && defaultWorkingDays[time.Weekday(weekday)] {
+		for _, session := range []string{"morning", "afternoon"} {
+			h := sessionHours[session]
+			windows = append(windows, window{h.start, h.end})
+		}
+	}
+	return windows, nil
+}
+
+// checkDoctorSchedule rejects a doctor booking of [start, end) on a clinic closure or
+// not fully inside one of the doctor's working windows.
+func checkDoctorSchedule(ctx context.Context, q querier, doctorID string, start, end time.Time) error {
+	if reason, closed, err := clinicClosure(ctx, q, start); err != nil {
+		return err
+	} else if closed {
+		return &bookingError{reason}
+	}
+
+	windows, err := workingWindows(ctx, q, doctorID, start)
+	if err != nil {
+		return err
+	}
+	from := minuteOfDay(start)
+	to := from + int(end.Sub(start).Minutes())
+	for _, w := range windows {
+		if from >= w.start && to <= w.end {
+			return nil
+		}
+	}
+	return &bookingError{fmt.Sprintf("%s–%s is outside the doctor's working hours",
+		start.In(config.ClinicLocation()).Format("Mon 2006-01-02 15:04"),
+		end.In(config.ClinicLocation()).Format("15:04"))}
+}
+
+// checkSessionSchedule rejects a session booking on a clinic date (YYYY-MM-DD) the clinic
+// is closed.
+func checkSessionSchedule(ctx context.Context, q querier, date string) error {
+	day, err := time.ParseInLocation(time.DateOnly, date, config.ClinicLocation())
+	if err != nil {
+		return &bookingError{"appointment_date must be YYYY-MM-DD"}
+	}
+	reason, closed, err := clinicClosure(ctx, q, day)
+	if err != nil {
+		return err
+	}
+	if closed {
+		return &bookingError{reason}
+	}
+	return nil
+}
+
+func GetWorkingHours(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := db.QueryContext(c.Request.Context(), `
+			SELECT weekday, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+			FROM doctor_working_hours
+			WHERE doctor_id = $1
+			ORDER BY weekday, start_time
+		`, c.Param("doctor_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer rows.Close()
+
+		hours := []models.WorkingHours{}
+		for rows.Next() {
+			var h models.WorkingHours
+			if err := rows.Scan(&h.Weekday, &h.StartTime, &h.EndTime); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			hours = append(hours, h)
+		}
+		c.JSON(http.StatusOK, hours)
+	}
+}
+
+// SetWorkingHours replaces a doctor's whole weekly schedule. An empty list reverts the
+// doctor to the default session hours.
+func SetWorkingHours(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		doctorID := c.Param("doctor_id")
+		var req []models.WorkingHours
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		parsed := make([]window, len(req))
+		for i, h := range req {
+			start, err := parseClock(h.StartTime)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			end, err := parseClock(h.EndTime)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if h.Weekday < 0 || h.Weekday > 6 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "weekday must be between 0 (Sunday) and 6 (Saturday)"})
+				return
+			}
+			if end <= start {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "end_time must be after start_time"})
+				return
+			}
+			for j, prev := range parsed[:i] {
+				if req[j].Weekday == h.Weekday && start < prev.end && prev.start < end {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("working hours overlap on weekday %d", h.Weekday)})
+					return
+				}
+			}
+			parsed[i] = window{start, end}
+		}
+
+		ctx := c.Request.Context()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM doctors WHERE id = $1)
+		`, doctorID).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "doctor not found"})
+			return
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM doctor_working_hours WHERE doctor_id = $1
+		`, doctorID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, h := range req {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO doctor_working_hours (doctor_id, weekday, start_time, end_time)
+				VALUES ($1, $2, $3::time, $4::time)
+			`, doctorID, h.Weekday, h.StartTime, h.EndTime); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, req)
+	}
+}
+
+func GetClosures(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from := c.Query("from") // expected format: YYYY-MM-DD
+		to := c.Query("to")
+
+		var nullFrom, nullTo interface{}
+		if from != "" {
+			nullFrom = from
+		}
+		if to != "" {
+			nullTo = to
+		}
+
+		rows, err := db.QueryContext(c.Request.Context(), `
+			SELECT to_char(closure_date, 'YYYY-MM-DD'), reason
+			FROM clinic_closures
+			WHERE ($1::date IS NULL OR closure_date >= $1::date)
+			  AND ($2::date IS NULL OR closure_date <= $2::date)
+			ORDER BY closure_date
+		`, nullFrom, nullTo)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer rows.Close()
+
+		closures := []models.ClinicClosure{}
+		for rows.Next() {
+			var cl models.ClinicClosure
+			if err := rows.Scan(&cl.Date, &cl.Reason); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			closures = append(closures, cl)
+		}
+		c.JSON(http.StatusOK, closures)
+	}
+}
+
+func SetClosure(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		date := c.Param("date")
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+			return
+		}
+		// the body (a reason) is optional
+		var req models.ClinicClosure
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Date = date
+
+		_, err := db.ExecContext(c.Request.Context(), `
+			INSERT INTO clinic_closures (closure_date, reason)
+			VALUES ($1::date, $2)
+			ON CONFLICT (closure_date) DO UPDATE SET reason = EXCLUDED.reason
+		`, date, req.Reason)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, req)
+	}
+}
+
+func DeleteClosure(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		date := c.Param("date")
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+			return
+		}
+		res, err := db.ExecContext(c.Request.Context(), `
+			DELETE FROM clinic_closures WHERE closure_date = $1::date
+		`, date)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "closure not found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"appointment-service/events"
+	"appointment-service/models"
+)
+
+// statusEvents maps the clinic.events routing keys consumed from other services to the
+// status they move an appointment to.
+var statusEvents = map[string]models.Status{
+	"queue.checked_in":       models.StatusCheckedIn,
+	"queue.removed":          models.StatusNoShow, // declined or timed out after arriving late
+	"consultation.completed": models.StatusCompleted,
+}
+
+// statusEventSteps lists, for a target status, the status an event may pass through when
+// the appointment can't move there directly. A consultation.completed for a patient who was
+// checked in but never marked in_progress still completes, via in_progress.
+var statusEventSteps = map[models.Status]models.Status{
+	models.StatusCompleted: models.StatusInProgress,
+}
+
+// StatusEventKeys returns the routing keys ApplyStatusEvent handles.
+func StatusEventKeys() []string {
+	keys := make([]string, 0, len(statusEvents))
+	for k := range statusEvents {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+type statusEventBody struct {
+	AppointmentID string  `json:"appointment_id"`
+	Reason        *string `json:"reason"`
+}
+
+// ApplyStatusEvent moves an appointment's status in response to a queue or consultation
+// event, through the same transition rules, history and outbox as PATCH /:id/status.
+// Each event ID is applied at most once; a transition that has already happened, or one for
+// an appointment that has already ended, is treated as done, and anything else the
+// lifecycle rejects is dead-lettered.
+func ApplyStatusEvent(db *sql.DB) events.Handler {
+	return func(ctx context.Context, msg events.Message) error {
+		next, ok := statusEvents[msg.RoutingKey]
+		if !ok {
+			return events.Permanent(fmt.Errorf("unexpected routing key %q", msg.RoutingKey))
+		}
+		var body statusEventBody
+		if err := json.Unmarshal(msg.Body, &body); err != nil {
+			return events.Permanent(fmt.Errorf("invalid JSON: %w", err))
+		}
+		if !uuidPattern.MatchString(body.AppointmentID) {
+			return events.Permanent(fmt.Errorf("invalid appointment_id %q", body.AppointmentID))
+		}
+		reason := "via " + msg.RoutingKey
+		if body.Reason != nil && *body.Reason != "" {
+			reason += ": " + *body.Reason
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO processed_events (event_id, routing_key)
+			VALUES ($1, $2)
+			ON CONFLICT (event_id) DO NOTHING
+		`, msg.ID, msg.RoutingKey)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil // already applied
+		}
+
+		_, err = transitionStatus(ctx, tx, body.AppointmentID, next, "", &reason, nil)
+		var te *transitionError
+		if via, ok := statusEventSteps[next]; ok && errors.As(err, &te) && te.From.CanTransitionTo(via) {
+			if _, err = transitionStatus(ctx, tx, body.AppointmentID, via, "", &reason, nil); err == nil {
+				_, err = transitionStatus(ctx, tx, body.AppointmentID, next, "", &reason, nil)
+			}
+		}
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return events.Permanent(fmt.Errorf("appointment %s not found", body.AppointmentID))
+		case errors.As(err, &te) && eventSuperseded(te, next):
+			// already settled, e.g. by the HTTP endpoint; just record the event as seen
+			if te.From != next {
+				log.Printf("event %s %s: appointment %s is already %s, ignoring", msg.RoutingKey, msg.ID, body.AppointmentID, te.From)
+			}
+		case errors.As(err, &te):
+			return events.Permanent(err)
+		case err != nil:
+			return err
+		}
+		return tx.Commit()
+	}
+}
+
+// eventSuperseded reports whether an event that can't move an appointment to next needs no
+// action: the appointment is already there, or has already ended, e.g. queue.removed after
+// staff cancelled it or consultation.completed after the no-show sweeper took it.
+func eventSuperseded(te *transitionError, next models.Status) bool {
+	return te.From == next || te.From.IsFinal()
+}
+
+// RunProcessedEventPruner deletes processed_events rows older than retention every interval
+// until ctx is done. retention only has to outlast redeliveries of the same message.
+func RunProcessedEventPruner(ctx context.Context, db *sql.DB, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := db.ExecContext(ctx, `
+			DELETE FROM processed_events WHERE processed_at < NOW() - $1 * INTERVAL '1 second'
+		`, int64(retention.Seconds())); err != nil && ctx.Err() == nil {
+			log.Printf("pruning processed events: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"appointment-service/events"
+	"appointment-service/models"
+)
+
+func TestEventSuperseded(t *testing.T) {
+	tests := []struct {
+		from, next models.Status
+		want       bool
+	}{
+		// queue.removed for a booking staff already cancelled or that already finished
+		{models.StatusCancelled, models.StatusNoShow, true},
+		{models.StatusCompleted, models.StatusNoShow, true},
+		{models.StatusNoShow, models.StatusNoShow, true},
+		// consultation.completed after the booking ended some other way
+		{models.StatusCancelled, models.StatusCompleted, true},
+		{models.StatusNoShow, models.StatusCompleted, true},
+		{models.StatusCompleted, models.StatusCompleted, true},
+		// queue.checked_in for a booking already checked in, or past it
+		{models.StatusCheckedIn, models.StatusCheckedIn, true},
+		// still open but the move is illegal: a genuine error, dead-lettered
+		{models.StatusInProgress, models.StatusCheckedIn, false},
+		{models.StatusInProgress, models.StatusNoShow, false},
+		{models.StatusScheduled, models.StatusCompleted, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.next), func(t *testing.T) {
+			te := &transitionError{From: tt.from, To: tt.next}
+			if got := eventSuperseded(te, tt.next); got != tt.want {
+				t.Errorf("eventSuperseded(%s -> %s) = %v, want %v", tt.from, tt.next, got, tt.want)
+			}
+		})
+	}
+}
+
+// Malformed events are dead-lettered before the database is touched.
+func TestApplyStatusEventRejectsMalformed(t *testing.T) {
+	apply := ApplyStatusEvent(nil)
+	tests := []struct {
+		name string
+		msg  events.Message
+	}{
+		{"unknown routing key", events.Message{ID: "1", RoutingKey: "queue.called", Body: []byte(`{}`)}},
+		{"bad JSON", events.Message{ID: "2", RoutingKey: "queue.removed", Body: []byte(`{`)}},
+		{"bad appointment_id", events.Message{ID: "3", RoutingKey: "queue.removed", Body: []byte(`{"appointment_id":"42"}`)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := apply(context.Background(), tt.msg)
+			if !events.IsPermanent(err) {
+				t.Fatalf("ApplyStatusEvent() = %v, want a permanent error", err)
+			}
+		})
+	}
+}
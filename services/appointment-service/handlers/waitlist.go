@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"appointment-service/middleware"
+	"appointment-service/models"
+	"github.com/gin-gonic/gin"
+)
+
+// waitlistColumns is the SELECT/RETURNING list matched by scanWaitlistEntry.
+const waitlistColumns = `id::text, patient_id, doctor_id, start_time, duration_minutes,
+	session, to_char(session_date, 'YYYY-MM-DD'), notes, status, appointment_id::text,
+	created_at, promoted_at`
+
+func scanWaitlistEntry(row rowScanner) (models.WaitlistEntry, error) {
+	var w models.WaitlistEntry
+	err := row.Scan(
+		&w.ID, &w.PatientID, &w.DoctorID, &w.StartTime, &w.Duration,
+		&w.Session, &w.SessionDate, &w.Notes, &w.Status, &w.AppointmentID,
+		&w.CreatedAt, &w.PromotedAt,
+	)
+	return w, err
+}
+
+// JoinWaitlist queues a patient for a doctor slot or session that is currently full.
+// If the slot still has room the caller gets a 409 and should book it directly.
+func JoinWaitlist(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.CreateWaitlistRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !canBookFor(c, req.PatientID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "patients can only join the waitlist for themselves"})
+			return
+		}
+		if err := validateBooking(req.DoctorID, req.StartTime, req.Session, req.Date); err != nil {
+			respondBookingError(c, err)
+			return
+		}
+		if err := checkBookingPolicy(middleware.Role(c), req.StartTime, req.Session, req.Date); err != nil {
+			respondBookingError(c, err)
+			return
+		}
+
+		ctx := c.Request.Context()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		var duration *int
+		if req.DoctorID != nil {
+			// an unknown doctor is reported by checkDoctorBooking below
+			var minutes int
+			minutes, err = resolveDuration(ctx, tx, *req.DoctorID, req.Duration)
+			if err != nil && err != sql.ErrNoRows {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			duration = &minutes
+			_, err = checkDoctorBooking(ctx, tx, *req.DoctorID, *req.StartTime, duration, "")
+		} else {
+			err = checkSessionSchedule(ctx, tx, *req.Date)
+			if err == nil {
+				err = checkSessionCapacity(ctx, tx, *req.Date, *req.Session, "")
+			}
+		}
+		if err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "slot still has capacity; book it directly"})
+			return
+		}
+		if !errors.Is(err, errSlotFull) && !errors.Is(err, errSessionFull) {
+			respondBookingError(c, err)
+			return
+		}
+
+		w, err := scanWaitlistEntry(tx.QueryRowContext(ctx, `
+			INSERT INTO waitlist_entries (patient_id, doctor_id, start_time, duration_minutes, session, session_date, notes)
+			VALUES ($1, $2, $3, $4, $5, $6::date, $7)
+			ON CONFLICT DO NOTHING
+			RETURNING `+waitlistColumns,
+			req.PatientID, req.DoctorID, req.StartTime, duration, req.Session, req.Date, req.Notes))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusConflict, gin.H{"error": "patient is already on the waitlist for this slot"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordWaitlistEvent(ctx, tx, w.ID, nil, models.EventJoined, actorID(c), nil, snapshotWaitlist(w), nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, w)
+	}
+}
+
+func GetWaitlist(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		patientID := c.Query("patient_id")
+		doctorID := c.Query("doctor_id")
+		status := c.Query("status")
+		var unassigned bool
+		if !scopeListFilters(c, &patientID, &doctorID, &unassigned) {
+			return
+		}
+
+		var nullPatient, nullDoctor, nullStatus interface{}
+		if patientID != "" {
+			nullPatient = patientID
+		}
+		if doctorID != "" {
+			nullDoctor = doctorID
+		}
+		if status != "" {
+			nullStatus = status
+		}
+
+		rows, err := db.QueryContext(c.Request.Context(), `
+			SELECT `+waitlistColumns+`
+			FROM waitlist_entries
+			WHERE ($1::text IS NULL OR patient_id = $1)
+			  AND ($2::text IS NULL OR doctor_id = $2 OR ($4 AND doctor_id IS NULL))
+			  AND ($3::text IS NULL OR status = $3)
+			ORDER BY created_at ASC
+		`, nullPatient, nullDoctor, nullStatus, unassigned)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer rows.Close()
+
+		entries := []models.WaitlistEntry{}
+		for rows.Next() {
+			w, err := scanWaitlistEntry(rows)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			entries = append(entries, w)
+		}
+		respondCacheable(c, entries)
+	}
+}
+
+func LeaveWaitlist(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var patientID string
+		var doctorID *string
+		err := db.QueryRowContext(c.Request.Context(), `
+			SELECT patient_id, doctor_id FROM waitlist_entries WHERE id = $1::uuid
+		`, c.Param("entry_id")).Scan(&patientID, &doctorID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "waitlist entry not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !canModify(c, patientID, doctorID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to access this waitlist entry"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		w, err := scanWaitlistEntry(tx.QueryRowContext(ctx, `
+			UPDATE waitlist_entries
+			SET status = $1
+			WHERE id = $2::uuid AND status = $3
+			RETURNING `+waitlistColumns,
+			models.WaitlistCancelled, c.Param("entry_id"), models.WaitlistWaiting))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusConflict, gin.H{"error": "waitlist entry is no longer waiting"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		err = recordWaitlistEvent(ctx, tx, w.ID, nil, models.EventLeft, actorID(c),
+			waitlistSnapshot{Status: models.WaitlistWaiting}, waitlistSnapshot{Status: w.Status}, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, w)
+	}
+}
+
+// resolveDuration returns the requested duration or the doctor's default.
+func resolveDuration(ctx context.Context, q querier, doctorID string, requested *int) (int, error) {
+	if requested != nil {
+		return *requested, nil
+	}
+	var minutes int
+	err := q.QueryRowContext(ctx, `
+		SELECT default_duration_minutes FROM doctors WHERE id = $1
+	`, doctorID).Scan(&minutes)
+	return minutes, err
+}
+
+// promoteWaitlist books the earliest waiting entries that fit into the capacity freed by
+// freed, in tx. Each promotion is recorded in the appointment history.
+func promoteWaitlist(ctx context.Context, tx *sql.Tx, freed models.Appointment) error {
+	if freed.DoctorID != nil && freed.StartTime != nil && freed.EndTime != nil {
+		return promoteDoctorWaitlist(ctx, tx, *freed.DoctorID, *freed.StartTime, *freed.EndTime)
+	}
+	if freed.Session != nil {
+		return promoteSessionWaitlist(ctx, tx, *freed.Session, *freed.Date)
+	}
+	return nil
+}
+
+func promoteDoctorWaitlist(ctx context.Context, tx *sql.Tx, doctorID string, from, to time.Time) error {
+	// read every candidate before issuing further queries on tx
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+waitlistColumns+`
+		FROM waitlist_entries
+		WHERE status = 'waiting'
+		  AND doctor_id = $1
+		  AND start_time < $3
+		  AND start_time + duration_minutes * INTERVAL '1 minute' > $2
+		  AND start_time > NOW()
+		ORDER BY created_at, id
+		FOR UPDATE SKIP LOCKED
+	`, doctorID, from, to)
+	if err != nil {
+		return err
+	}
+	var candidates []models.WaitlistEntry
+	for rows.Next() {
+		w, err := scanWaitlistEntry(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		candidates = append(candidates, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, w := range candidates {
+		end, err := checkDoctorBooking(ctx, tx, doctorID, *w.StartTime, w.Duration, "")
+		if err == nil {
+			err = checkPatientBooking(ctx, tx, w.PatientID, w.StartTime, &end, nil, nil, "")
+		}
+		var be *bookingError
+		var pe *patientRuleError
+		if errors.Is(err, errSlotFull) || errors.As(err, &be) || errors.As(err, &pe) {
+			continue // still full for this entry, the doctor's hours changed, or the patient has booked elsewhere since
+		}
+		if err != nil {
+			return err
+		}
+		if err := promoteEntry(ctx, tx, w, &end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func promoteSessionWaitlist(ctx context.Context, tx *sql.Tx, session, date string) error {
+	// a session that is already over has nothing to promote into
+	if validateSessionDate(session, &date) != nil {
+		return nil
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+waitlistColumns+`
+		FROM waitlist_entries
+		WHERE status = 'waiting'
+		  AND session = $1
+		  AND session_date = $2::date
+		ORDER BY created_at, id
+		FOR UPDATE SKIP LOCKED
+	`, session, date)
+	if err != nil {
+		return err
+	}
+	var candidates []models.WaitlistEntry
+	for rows.Next() {
+		w, err := scanWaitlistEntry(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		candidates = append(candidates, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, w := range candidates {
+		err := checkSessionCapacity(ctx, tx, date, session, "")
+		if errors.Is(err, errSessionFull) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = checkPatientBooking(ctx, tx, w.PatientID, nil, nil, w.Session, w.SessionDate, "")
+		var pe *patientRuleError
+		if errors.As(err, &pe) {
+			continue // the patient has booked elsewhere since joining
+		}
+		if err != nil {
+			return err
+		}
+		if err := promoteEntry(ctx, tx, w, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// promoteEntry books w and marks it promoted. Capacity must already have been checked.
+func promoteEntry(ctx context.Context, tx *sql.Tx, w models.WaitlistEntry, end *time.Time) error {
+	a, err := insertAppointment(ctx, tx, w.PatientID, w.DoctorID, w.StartTime, end, w.Session, w.SessionDate, w.Notes)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE waitlist_entries
+		SET status = $1, appointment_id = $2::uuid, promoted_at = NOW()
+		WHERE id = $3::uuid
+	`, models.WaitlistPromoted, a.ID, w.ID)
+	if err != nil {
+		return err
+	}
+	reason := "promoted from waitlist"
+	err = recordWaitlistEvent(ctx, tx, w.ID, &a.ID, models.EventPromoted, "",
+		map[string]string{"waitlist_entry_id": w.ID}, snapshotBooking(a), &reason)
+	if err != nil {
+		return err
+	}
+	return enqueueEvent(ctx, tx, routingBooked, a, &reason, nil)
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"log"
 	"net/http"
+	"time"
 
+	"appointment-service/config"
 	"appointment-service/db"
 	"appointment-service/docs"
+	"appointment-service/events"
 	"appointment-service/handlers"
 	"appointment-service/middleware"
 
@@ -17,14 +22,16 @@ import (
 func main(){
 	_ = godotenv.Load() // loads .env for local dev; no-op in Docker
 
-	pubKey, err := middleware.FetchPublicKey()
-	if err != nil {
-		log.Fatalf("failed to load auth public key: %v", err)
-	}
+	auth := loadAuthenticator()
 
 	database := db.Connect()
 	defer database.Close()
 
+	startOutboxRelay(database)
+	startEventConsumer(database)
+	go handlers.RunIdempotencyPruner(context.Background(), database, time.Hour)
+	go handlers.RunNoShowSweeper(context.Background(), database, config.NoShowSweepInterval(), config.NoShowGrace())
+
 	router := gin.Default()
 
 	router.GET("/health", func(c *gin.Context) {
@@ -37,13 +44,108 @@ func main(){
 		c.Data(http.StatusOK, "application/json", []byte(docs.SwaggerJSON))
 	})
 
-	appts := router.Group("/appointments", middleware.RequireAuth(pubKey))
+	appts := router.Group("/appointments", middleware.RequireAuth(auth))
+	// per-row ownership (patients: own bookings, doctors: own patients) is enforced in handlers
+	staffOnly := middleware.RequireRole(middleware.RoleStaff, middleware.RoleAdmin)
+	queueWriters := middleware.Require(middleware.Policy{
+		Roles:  []string{middleware.RoleStaff, middleware.RoleAdmin},
+		Scopes: []string{middleware.ScopeWriteQueue},
+	})
+	clinicians := middleware.Require(middleware.Policy{
+		Roles:  []string{middleware.RoleStaff, middleware.RoleDoctor, middleware.RoleAdmin},
+		Scopes: []string{middleware.ScopeWriteStatus},
+	})
+	// front-desk kiosks sign in as staff or as a service with the write-status scope
+	frontDesk := middleware.Require(middleware.Policy{
+		Roles:  []string{middleware.RoleStaff, middleware.RoleAdmin},
+		Scopes: []string{middleware.ScopeWriteStatus},
+	})
 	{
 		appts.GET("",		handlers.GetAppointments(database))
 		appts.POST("",		handlers.CreateAppointment(database))
+		appts.GET("/availability",     handlers.GetAvailability(database))
+		appts.GET("/waitlist",         handlers.GetWaitlist(database))
+		appts.POST("/waitlist",        handlers.JoinWaitlist(database))
+		appts.DELETE("/waitlist/:entry_id", handlers.LeaveWaitlist(database))
+		appts.GET("/waitlist/:entry_id/history", handlers.GetWaitlistHistory(database))
+		appts.PUT("/queue-snapshot",   queueWriters, handlers.ApplyQueueSnapshot(database))
+		appts.PUT("/session-capacity", staffOnly, handlers.SetSessionCapacity(database))
+		appts.PATCH("/doctors/:doctor_id/slot-settings", staffOnly, handlers.UpdateDoctorSlotSettings(database))
+		appts.GET("/doctors/:doctor_id/working-hours", handlers.GetWorkingHours(database))
+		appts.PUT("/doctors/:doctor_id/working-hours", staffOnly, handlers.SetWorkingHours(database))
+		appts.GET("/closures",          handlers.GetClosures(database))
+		appts.PUT("/closures/:date",    staffOnly, handlers.SetClosure(database))
+		appts.DELETE("/closures/:date", staffOnly, handlers.DeleteClosure(database))
 		appts.GET("/:id",	handlers.GetAppointment(database))
-		appts.PATCH("/:id/status",  handlers.UpdateAppointmentStatus(database))
+		appts.GET("/:id/history",   handlers.GetAppointmentHistory(database))
+		appts.PATCH("/:id/status",  clinicians, handlers.UpdateAppointmentStatus(database))
+		appts.POST("/:id/check-in-code", handlers.IssueCheckInCode(database))
+		appts.POST("/:id/check-in",  frontDesk, handlers.CheckInAppointment(database))
+		appts.PATCH("/:id/reschedule", handlers.RescheduleAppointment(database))
 		appts.DELETE("/:id",         handlers.CancelAppointment(database))
 	}
 	router.Run(":3001")
+}
+
+// startOutboxRelay publishes the events handlers write to the outbox. Every write enqueues
+// an event, so running without RABBITMQ_URL is fatal outside development; there events are
+// kept in the outbox and sent once a broker is configured.
+func startOutboxRelay(database *sql.DB) {
+	url := config.RabbitMQURL()
+	if url == "" {
+		if !config.IsDevelopment() {
+			log.Fatal("RABBITMQ_URL is not set; appointment events would never leave the outbox")
+		}
+		log.Println("************************************************************")
+		log.Println("WARNING: RABBITMQ_URL is not set, so no outbox relay is running.")
+		log.Println("Appointment events will pile up in appointments.outbox and no")
+		log.Println("other service will hear about bookings until a broker is set.")
+		log.Println("************************************************************")
+		return
+	}
+	relay := events.NewRelay(database, events.NewAMQPPublisher(url),
+		config.OutboxBatchSize(), config.OutboxPollInterval(), config.OutboxRetention())
+	go relay.Run(context.Background())
+}
+
+// startEventConsumer applies queue and consultation events as status transitions when
+// EVENT_CONSUMER_ENABLED is set. Poison messages, and messages still failing after
+// EVENT_MAX_ATTEMPTS tries, end up in appointment-service.status-events.dlq.
+func startEventConsumer(database *sql.DB) {
+	if !config.EventConsumerEnabled() {
+		return
+	}
+	url := config.RabbitMQURL()
+	if url == "" {
+		log.Fatal("EVENT_CONSUMER_ENABLED requires RABBITMQ_URL")
+	}
+	consumer := events.NewConsumer(url, "appointment-service.status-events",
+		handlers.StatusEventKeys(), handlers.ApplyStatusEvent(database), config.EventMaxAttempts())
+	go consumer.Run(context.Background())
+	go handlers.RunProcessedEventPruner(context.Background(), database, time.Hour, config.ProcessedEventRetention())
+}
+
+// loadAuthenticator builds the token validator: trusted RS256 issuers normally, or the
+// JWT_SECRET HS256 mode for local development when no JWKS is configured.
+func loadAuthenticator() *middleware.Authenticator {
+	if secret := config.LocalJWTSecret(); secret != "" {
+		log.Println("************************************************************")
+		log.Println("WARNING: HS256 local auth mode is ON (JWT_SECRET, no JWKS_URL).")
+		log.Println("Anyone holding JWT_SECRET can mint tokens for any user or role.")
+		log.Println("Never run this configuration outside local development.")
+		log.Println("************************************************************")
+		return middleware.NewLocalAuthenticator(secret)
+	}
+
+	issuers, err := middleware.LoadIssuers(config.AuthIssuers(), config.JWKSURL(), config.CognitoClientID())
+	if err != nil {
+		log.Fatalf("failed to load trusted issuers: %v", err)
+	}
+	auth, err := middleware.NewAuthenticator(issuers, config.JWKSMinRefreshGap())
+	if err != nil {
+		log.Fatalf("failed to load trusted issuers: %v", err)
+	}
+	// keys are fetched in the background so the service starts even if an issuer is down
+	auth.Run(context.Background(), config.JWKSRefreshInterval())
+	return auth
 }
\ No newline at end of file
@@ -1,72 +1,17 @@
 package middleware
 
 import (
-	"crypto/rsa"
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
 	"log"
-	"math/big"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-type jwkKey struct {
-	Kty string `json:"kty"`
-	Alg string `json:"alg"`
-	Kid string `json:"kid"`
-	N   string `json:"n"` // RSA modulus (base64url)
-	E   string `json:"e"` // RSA exponent (base64url)
-}
-
-type jwksResponse struct {
-	Keys []jwkKey `json:"keys"`
-}
-
-// FetchPublicKey retrieves the RS256 public key from the auth-service JWKS endpoint.
-// Called once at startup — the service cannot run without it.
-func FetchPublicKey() (*rsa.PublicKey, error) {
-	url := os.Getenv("JWKS_URL")
-	if url == "" {
-		url = "http://auth-service:3000/api/auth/jwks"
-	}
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch JWKS from %s: %w", url, err)
-	}
-	defer resp.Body.Close()
-
-	var body jwksResponse
-	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
-		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
-	}
-
-	for _, k := range body.Keys {
-		if k.Kty == "RSA" || k.Alg == "RS256" {
-			nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decode RSA modulus: %w", err)
-			}
-			eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decode RSA exponent: %w", err)
-			}
-			return &rsa.PublicKey{
-				N: new(big.Int).SetBytes(nBytes),
-				E: int(new(big.Int).SetBytes(eBytes).Int64()),
-			}, nil
-		}
-	}
-
-	return nil, fmt.Errorf("no RSA key found in JWKS response")
-}
-
-// RequireAuth returns a Gin middleware that validates RS256 JWTs issued by the auth-service.
-func RequireAuth(pubKey *rsa.PublicKey) gin.HandlerFunc {
+// RequireAuth returns a Gin middleware that validates RS256 JWTs from the trusted issuers
+// configured in auth. Tokens from any other issuer get a 401.
+func RequireAuth(auth *Authenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		header := c.GetHeader("Authorization")
 		if !strings.HasPrefix(header, "Bearer ") {
@@ -75,27 +20,109 @@ func RequireAuth(pubKey *rsa.PublicKey) gin.HandlerFunc {
 		}
 		tokenStr := strings.TrimPrefix(header, "Bearer ")
 
-		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-			}
-			return pubKey, nil
-		},
-			jwt.WithExpirationRequired(),
-		)
-		if err != nil || !token.Valid {
+		id, err := auth.verify(c.Request.Context(), tokenStr)
+		if err != nil {
 			log.Printf("token validation failed: %v", err)
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token claims"})
-			return
+		c.Set("user_id", id.userID)
+		c.Set("issuer", id.issuer)
+		if id.machine {
+			c.Set("role", RoleService)
+			c.Set("scopes", id.scopes)
+		} else {
+			c.Set("role", id.role)
 		}
-
-		c.Set("user_id", claims["sub"])
 		c.Next()
 	}
 }
+
+// Roles carried in the JWT, matching betterauth."user".role.
+const (
+	RolePatient = "patient"
+	RoleDoctor  = "doctor"
+	RoleStaff   = "staff"
+	RoleAdmin   = "admin"
+
+	// RoleService marks a machine identity (client-credentials or internal token). It is
+	// never read from a claim; what a service may do is decided by its scopes.
+	RoleService = "service"
+)
+
+// Scopes granted to machine identities.
+const (
+	ScopeRead        = "appointments:read"
+	ScopeWrite       = "appointments:write"        // book, cancel and reschedule on a patient's behalf
+	ScopeWriteStatus = "appointments:write-status" // drive the status lifecycle
+	ScopeWriteQueue  = "appointments:write-queue"  // set queue_position and estimated_time
+)
+
+// normaliseRole maps a role claim onto the known roles. Tokens without one are treated as
+// patients, the least privileged role.
+func normaliseRole(role string) string {
+	role = strings.ToLower(role)
+	switch role {
+	case RoleDoctor, RoleStaff, RoleAdmin:
+		return role
+	default:
+		return RolePatient
+	}
+}
+
+// Role returns the caller's role as set by RequireAuth.
+func Role(c *gin.Context) string {
+	return c.GetString("role")
+}
+
+// IsService reports whether the caller is a machine identity.
+func IsService(c *gin.Context) bool {
+	return Role(c) == RoleService
+}
+
+// HasScope reports whether the caller is a machine identity granted scope. Human callers
+// never have scopes; they are authorised by role.
+func HasScope(c *gin.Context, scope string) bool {
+	scopes, _ := c.Get("scopes")
+	granted, _ := scopes.([]string)
+	return slices.Contains(granted, scope)
+}
+
+// Policy lists who may call a route: humans with one of Roles, or machine identities
+// holding one of Scopes.
+type Policy struct {
+	Roles  []string
+	Scopes []string
+}
+
+// Require rejects callers not allowed by p with 403. It must run after RequireAuth.
+func Require(p Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsService(c) {
+			for _, s := range p.Scopes {
+				if HasScope(c, s) {
+					c.Next()
+					return
+				}
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient scope"})
+			return
+		}
+		if slices.Contains(p.Roles, Role(c)) {
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
+	}
+}
+
+// RequireRole allows only human callers with one of roles.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return Require(Policy{Roles: roles})
+}
+
+// RequireScope allows only machine identities holding one of scopes.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return Require(Policy{Scopes: scopes})
+}
@@ -0,0 +1,273 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Issuer is one trusted token issuer. A token is accepted only if its iss matches an
+// Issuer exactly and it passes that issuer's audience and token_use checks.
+type Issuer struct {
+	Name    string `json:"name"`
+	Issuer  string `json:"issuer"` // expected iss claim
+	JWKSURL string `json:"jwks_url"`
+
+	// Audience lists the accepted aud values. Cognito access tokens carry no aud, so
+	// client_id is matched against the same list. Empty skips the check.
+	Audience []string `json:"audience"`
+
+	// TokenUse is the expected Cognito token_use claim ("id" or "access"). Empty skips it.
+	TokenUse string `json:"token_use"`
+
+	// Claim names holding the user ID, role and machine scopes; default "sub", "role"
+	// and "scope". Scopes may be a space-separated string or an array.
+	UserIDClaim string `json:"user_id_claim"`
+	RoleClaim   string `json:"role_claim"`
+	ScopeClaim  string `json:"scope_claim"`
+
+	// MachineClients lists the OAuth client IDs whose client-credentials tokens (user ID
+	// claim equal to client_id, as Cognito issues them) are accepted as service identities.
+	// Such tokens must be access tokens when TokenUse is set, and any aud they carry must
+	// be in Audience; Cognito issues them without one.
+	MachineClients []string `json:"machine_clients"`
+
+	// MachineOnly marks an internal signer: every token it issues is a service identity.
+	MachineOnly bool `json:"machine_only"`
+
+	keys *JWKS
+}
+
+// Default BetterAuth token settings, matching services/auth-service/src/auth.ts.
+const (
+	betterAuthIssuer   = "smart-clinic"
+	betterAuthAudience = "smart-clinic-services"
+	cognitoJWKSSuffix  = "/.well-known/jwks.json"
+)
+
+// LoadIssuers parses AUTH_ISSUERS (a JSON array of Issuer). When it is empty a single issuer
+// is derived from jwksURL the same way the Python services do: a Cognito JWKS URL trusts
+// ID tokens of that user pool issued to cognitoClientID, with the role in custom:role;
+// anything else is the local BetterAuth auth-service.
+func LoadIssuers(raw, jwksURL, cognitoClientID string) ([]Issuer, error) {
+	if strings.TrimSpace(raw) == "" {
+		if strings.HasSuffix(jwksURL, cognitoJWKSSuffix) {
+			// without an audience any app client of the pool could call us
+			if cognitoClientID == "" {
+				return nil, fmt.Errorf("JWKS_URL points at Cognito but COGNITO_CLIENT_ID is not set")
+			}
+			return []Issuer{{
+				Name:      "cognito",
+				Issuer:    strings.TrimSuffix(jwksURL, cognitoJWKSSuffix),
+				JWKSURL:   jwksURL,
+				Audience:  []string{cognitoClientID},
+				TokenUse:  "id",
+				RoleClaim: "custom:role",
+			}}, nil
+		}
+		return []Issuer{{
+			Name:     "betterauth",
+			Issuer:   betterAuthIssuer,
+			JWKSURL:  jwksURL,
+			Audience: []string{betterAuthAudience},
+		}}, nil
+	}
+
+	var issuers []Issuer
+	if err := json.Unmarshal([]byte(raw), &issuers); err != nil {
+		return nil, fmt.Errorf("invalid AUTH_ISSUERS: %w", err)
+	}
+	if len(issuers) == 0 {
+		return nil, fmt.Errorf("invalid AUTH_ISSUERS: no issuers configured")
+	}
+	return issuers, nil
+}
+
+// Authenticator validates tokens against a fixed set of trusted issuers, or against a
+// shared secret in local mode.
+type Authenticator struct {
+	issuers map[string]*Issuer // by iss
+	secret  []byte             // HS256 key; set only in local mode
+}
+
+// NewLocalAuthenticator validates HS256 tokens signed with secret, with the user ID in sub
+// and the role in role; tokens whose sub equals client_id are service identities with
+// scopes in scope. Issuer and audience are not checked. For local development only.
+func NewLocalAuthenticator(secret string) *Authenticator {
+	return &Authenticator{secret: []byte(secret)}
+}
+
+func NewAuthenticator(issuers []Issuer, minRefreshGap time.Duration) (*Authenticator, error) {
+	a := &Authenticator{issuers: map[string]*Issuer{}}
+	for i := range issuers {
+		iss := issuers[i]
+		if iss.Issuer == "" || iss.JWKSURL == "" {
+			return nil, fmt.Errorf("issuer %q: issuer and jwks_url are required", iss.Name)
+		}
+		if _, dup := a.issuers[iss.Issuer]; dup {
+			return nil, fmt.Errorf("issuer %q is configured twice", iss.Issuer)
+		}
+		if iss.TokenUse != "" && iss.TokenUse != "id" && iss.TokenUse != "access" {
+			return nil, fmt.Errorf("issuer %q: token_use must be id or access", iss.Issuer)
+		}
+		if iss.UserIDClaim == "" {
+			iss.UserIDClaim = "sub"
+		}
+		if iss.RoleClaim == "" {
+			iss.RoleClaim = "role"
+		}
+		if iss.ScopeClaim == "" {
+			iss.ScopeClaim = "scope"
+		}
+		if iss.Name == "" {
+			iss.Name = iss.Issuer
+		}
+		iss.keys = NewJWKS(iss.JWKSURL, minRefreshGap)
+		a.issuers[iss.Issuer] = &iss
+	}
+	return a, nil
+}
+
+// Run keeps every issuer's key set fresh until ctx is done.
+func (a *Authenticator) Run(ctx context.Context, interval time.Duration) {
+	for _, iss := range a.issuers {
+		go iss.keys.Run(ctx, interval)
+	}
+}
+
+// identity is what a validated token says about its caller.
+type identity struct {
+	issuer  string
+	userID  string
+	role    string
+	machine bool
+	scopes  []string
+}
+
+// verify checks tokenStr's signature and standard claims against the issuer named in its
+// iss claim, then applies that issuer's audience and token_use rules.
+func (a *Authenticator) verify(ctx context.Context, tokenStr string) (identity, error) {
+	if a.secret != nil {
+		return a.verifyLocal(tokenStr)
+	}
+
+	var iss *Issuer
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		claimed, _ := t.Claims.GetIssuer()
+		iss = a.issuers[claimed]
+		if iss == nil {
+			return nil, fmt.Errorf("untrusted issuer %q", claimed)
+		}
+		kid, _ := t.Header["kid"].(string)
+		return iss.keys.Key(ctx, kid)
+	},
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return identity{}, err
+	}
+	claims := token.Claims.(jwt.MapClaims)
+
+	userID, _ := claims[iss.UserIDClaim].(string)
+	if userID == "" {
+		return identity{}, fmt.Errorf("missing %s claim", iss.UserIDClaim)
+	}
+
+	clientCredentials := isClientCredentials(claims, iss.UserIDClaim)
+	if clientCredentials && !iss.MachineOnly {
+		clientID := claims["client_id"].(string)
+		if !slices.Contains(iss.MachineClients, clientID) {
+			return identity{}, fmt.Errorf("client %q is not an allowed machine client of issuer %q", clientID, iss.Name)
+		}
+		if aud, _ := claims.GetAudience(); len(aud) > 0 && len(iss.Audience) > 0 && !iss.acceptsAudience(claims) {
+			return identity{}, fmt.Errorf("token audience not accepted by issuer %q", iss.Name)
+		}
+		// client-credentials grants only issue access tokens
+		if iss.TokenUse != "" && claims["token_use"] != "access" {
+			return identity{}, fmt.Errorf("issuer %q expects client-credentials tokens with token_use \"access\"", iss.Name)
+		}
+	} else {
+		if len(iss.Audience) > 0 && !iss.acceptsAudience(claims) {
+			return identity{}, fmt.Errorf("token audience not accepted by issuer %q", iss.Name)
+		}
+		if iss.TokenUse != "" && claims["token_use"] != iss.TokenUse {
+			return identity{}, fmt.Errorf("issuer %q expects token_use %q", iss.Name, iss.TokenUse)
+		}
+	}
+
+	id := identity{issuer: iss.Name, userID: userID}
+	if iss.MachineOnly || clientCredentials {
+		id.machine = true
+		id.scopes = scopesFromClaim(claims[iss.ScopeClaim])
+	} else {
+		role, _ := claims[iss.RoleClaim].(string)
+		id.role = normaliseRole(role)
+	}
+	return id, nil
+}
+
+// isClientCredentials reports whether claims come from an OAuth client-credentials grant,
+// where the subject, read from userIDClaim, is the client itself.
+func isClientCredentials(claims jwt.MapClaims, userIDClaim string) bool {
+	clientID, _ := claims["client_id"].(string)
+	subject, _ := claims[userIDClaim].(string)
+	return clientID != "" && clientID == subject
+}
+
+// scopesFromClaim accepts both the OAuth space-separated string and a JSON array.
+func scopesFromClaim(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var scopes []string
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
+
+func (iss *Issuer) acceptsAudience(claims jwt.MapClaims) bool {
+	aud, _ := claims.GetAudience()
+	for _, v := range aud {
+		if slices.Contains(iss.Audience, v) {
+			return true
+		}
+	}
+	clientID, _ := claims["client_id"].(string)
+	return clientID != "" && slices.Contains(iss.Audience, clientID)
+}
+
+func (a *Authenticator) verifyLocal(tokenStr string) (identity, error) {
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
+		return a.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return identity{}, err
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	userID, _ := claims["sub"].(string)
+	if userID == "" {
+		return identity{}, fmt.Errorf("missing sub claim")
+	}
+	if isClientCredentials(claims, "sub") {
+		return identity{issuer: "local", userID: userID, machine: true, scopes: scopesFromClaim(claims["scope"])}, nil
+	}
+	role, _ := claims["role"].(string)
+	return identity{issuer: "local", userID: userID, role: normaliseRole(role)}, nil
+}
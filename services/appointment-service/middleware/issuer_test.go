@@ -0,0 +1,331 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testCognitoIssuer  = "https://cognito-idp.ap-southeast-1.amazonaws.com/ap-southeast-1_test"
+	testInternalIssuer = "internal-signer"
+)
+
+// testAuthenticator trusts three issuers sharing one JWKS endpoint that publishes
+// testKey(t, 0) as k0: a Cognito user pool, an internal machine-only signer, and
+// BetterAuth with the user ID in uid.
+func testAuthenticator(t *testing.T) *Authenticator {
+	t.Helper()
+	srv := newJWKSServer(t, map[string]*rsa.PrivateKey{"k0": testKey(t, 0)})
+	auth, err := NewAuthenticator([]Issuer{
+		{
+			Name: "cognito", Issuer: testCognitoIssuer, JWKSURL: srv.URL,
+			Audience: []string{"app-client"}, TokenUse: "id", RoleClaim: "custom:role",
+			MachineClients: []string{"svc-client"},
+		},
+		{
+			Name: "internal", Issuer: testInternalIssuer, JWKSURL: srv.URL,
+			Audience: []string{betterAuthAudience}, MachineOnly: true,
+		},
+		{
+			Name: "betterauth", Issuer: betterAuthIssuer, JWKSURL: srv.URL,
+			Audience: []string{betterAuthAudience}, UserIDClaim: "uid",
+			MachineClients: []string{"svc-2"},
+		},
+	}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+	return auth
+}
+
+// signToken signs claims with RS256 and key, naming kid in the header.
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return s
+}
+
+// withClaims returns a copy of claims with extra merged in; an extra value of nil deletes
+// the claim.
+func withClaims(claims, extra jwt.MapClaims) jwt.MapClaims {
+	out := jwt.MapClaims{}
+	for k, v := range claims {
+		out[k] = v
+	}
+	for k, v := range extra {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// tokenClaims returns claims from issuer iss valid for an hour, with extra merged in.
+func tokenClaims(iss string, extra jwt.MapClaims) jwt.MapClaims {
+	return withClaims(jwt.MapClaims{"iss": iss, "exp": time.Now().Add(time.Hour).Unix()}, extra)
+}
+
+// cognitoIDClaims is a doctor's Cognito ID token for app-client, with extra merged in.
+func cognitoIDClaims(extra jwt.MapClaims) jwt.MapClaims {
+	return withClaims(tokenClaims(testCognitoIssuer, jwt.MapClaims{
+		"sub": "user-1", "aud": "app-client", "token_use": "id", "custom:role": "Doctor",
+	}), extra)
+}
+
+type verifyCase struct {
+	name  string
+	token string
+	want  identity // without a userID when an error is expected
+}
+
+func runVerifyCases(t *testing.T, auth *Authenticator, tests []verifyCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := auth.verify(t.Context(), tt.token)
+			if tt.want.userID == "" {
+				if err == nil {
+					t.Fatalf("verify() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("verify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	auth := testAuthenticator(t)
+	k0, k1 := testKey(t, 0), testKey(t, 1)
+	hs256, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, cognitoIDClaims(nil)).SignedString([]byte("guessed"))
+
+	tests := []verifyCase{
+		{"cognito id token", signToken(t, k0, "k0", cognitoIDClaims(nil)),
+			identity{issuer: "cognito", userID: "user-1", role: RoleDoctor}},
+		{"no role is a patient", signToken(t, k0, "k0", cognitoIDClaims(jwt.MapClaims{"custom:role": nil})),
+			identity{issuer: "cognito", userID: "user-1", role: RolePatient}},
+		{"unknown role is a patient", signToken(t, k0, "k0", cognitoIDClaims(jwt.MapClaims{"custom:role": "superuser"})),
+			identity{issuer: "cognito", userID: "user-1", role: RolePatient}},
+		{"role from another issuer's claim is ignored", signToken(t, k0, "k0", cognitoIDClaims(jwt.MapClaims{"custom:role": nil, "role": "admin"})),
+			identity{issuer: "cognito", userID: "user-1", role: RolePatient}},
+		{"issuer's user ID claim", signToken(t, k0, "k0", tokenClaims(betterAuthIssuer, jwt.MapClaims{
+			"uid": "user-2", "sub": "ignored", "aud": betterAuthAudience, "role": "staff",
+		})), identity{issuer: "betterauth", userID: "user-2", role: RoleStaff}},
+
+		{"forged signature", signToken(t, k1, "k0", cognitoIDClaims(nil)), identity{}},
+		{"unknown kid", signToken(t, k1, "k1", cognitoIDClaims(nil)), identity{}},
+		{"HS256", hs256, identity{}},
+		{"untrusted issuer", signToken(t, k0, "k0", cognitoIDClaims(jwt.MapClaims{"iss": "https://evil.example"})), identity{}},
+		{"no issuer", signToken(t, k0, "k0", cognitoIDClaims(jwt.MapClaims{"iss": nil})), identity{}},
+		{"wrong audience", signToken(t, k0, "k0", cognitoIDClaims(jwt.MapClaims{"aud": "other-client"})), identity{}},
+		{"no audience", signToken(t, k0, "k0", cognitoIDClaims(jwt.MapClaims{"aud": nil})), identity{}},
+		{"access token where id is expected", signToken(t, k0, "k0", cognitoIDClaims(jwt.MapClaims{
+			"aud": nil, "client_id": "app-client", "token_use": "access",
+		})), identity{}},
+		{"expired", signToken(t, k0, "k0", cognitoIDClaims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})), identity{}},
+		{"no expiry", signToken(t, k0, "k0", cognitoIDClaims(jwt.MapClaims{"exp": nil})), identity{}},
+		{"no user ID", signToken(t, k0, "k0", cognitoIDClaims(jwt.MapClaims{"sub": nil})), identity{}},
+		{"user ID only in sub where uid is expected", signToken(t, k0, "k0", tokenClaims(betterAuthIssuer, jwt.MapClaims{
+			"sub": "user-2", "aud": betterAuthAudience,
+		})), identity{}},
+		{"not a JWT", "not.a.jwt", identity{}},
+	}
+	runVerifyCases(t, auth, tests)
+}
+
+func TestLoadIssuers(t *testing.T) {
+	cognitoJWKS := testCognitoIssuer + cognitoJWKSSuffix
+
+	issuers, err := LoadIssuers("", cognitoJWKS, "app-client")
+	if err != nil {
+		t.Fatalf("LoadIssuers(cognito): %v", err)
+	}
+	want := []Issuer{{
+		Name: "cognito", Issuer: testCognitoIssuer, JWKSURL: cognitoJWKS,
+		Audience: []string{"app-client"}, TokenUse: "id", RoleClaim: "custom:role",
+	}}
+	if !reflect.DeepEqual(issuers, want) {
+		t.Errorf("LoadIssuers(cognito) = %+v, want %+v", issuers, want)
+	}
+
+	if _, err := LoadIssuers("", cognitoJWKS, ""); err == nil {
+		t.Error("LoadIssuers(cognito) without COGNITO_CLIENT_ID succeeded")
+	}
+
+	issuers, err = LoadIssuers("", "http://auth-service:3000/api/auth/jwks", "")
+	if err != nil {
+		t.Fatalf("LoadIssuers(betterauth): %v", err)
+	}
+	if len(issuers) != 1 || issuers[0].Issuer != betterAuthIssuer || !reflect.DeepEqual(issuers[0].Audience, []string{betterAuthAudience}) {
+		t.Errorf("LoadIssuers(betterauth) = %+v", issuers)
+	}
+
+	issuers, err = LoadIssuers(`[{"issuer":"a","jwks_url":"http://a/jwks","machine_only":true}]`, cognitoJWKS, "")
+	if err != nil {
+		t.Fatalf("LoadIssuers(AUTH_ISSUERS): %v", err)
+	}
+	if len(issuers) != 1 || issuers[0].Issuer != "a" || !issuers[0].MachineOnly {
+		t.Errorf("LoadIssuers(AUTH_ISSUERS) = %+v", issuers)
+	}
+
+	for _, raw := range []string{"[]", "{", `{"issuer":"a"}`} {
+		if _, err := LoadIssuers(raw, "", ""); err == nil {
+			t.Errorf("LoadIssuers(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestNewAuthenticatorRejectsBadIssuers(t *testing.T) {
+	tests := []struct {
+		name    string
+		issuers []Issuer
+	}{
+		{"no jwks_url", []Issuer{{Issuer: "a"}}},
+		{"no issuer", []Issuer{{JWKSURL: "http://a/jwks"}}},
+		{"duplicate", []Issuer{{Issuer: "a", JWKSURL: "http://a/jwks"}, {Issuer: "a", JWKSURL: "http://b/jwks"}}},
+		{"bad token_use", []Issuer{{Issuer: "a", JWKSURL: "http://a/jwks", TokenUse: "refresh"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewAuthenticator(tt.issuers, time.Minute); err == nil {
+				t.Error("NewAuthenticator() succeeded")
+			}
+		})
+	}
+}
+
+func TestRequireAuthAndScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auth := testAuthenticator(t)
+	k0 := testKey(t, 0)
+	machine := func(scope string) string {
+		return signToken(t, k0, "k0", tokenClaims(testInternalIssuer, jwt.MapClaims{
+			"sub": "queue-coordinator", "aud": betterAuthAudience, "scope": scope,
+		}))
+	}
+
+	router := gin.New()
+	router.Use(RequireAuth(auth))
+	router.PATCH("/status", Require(Policy{Roles: []string{RoleStaff, RoleDoctor}, Scopes: []string{ScopeWriteStatus}}),
+		func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"not bearer", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"invalid token", "Bearer " + signToken(t, testKey(t, 1), "k0", cognitoIDClaims(nil)), http.StatusUnauthorized},
+		{"doctor", "Bearer " + signToken(t, k0, "k0", cognitoIDClaims(nil)), http.StatusNoContent},
+		{"patient", "Bearer " + signToken(t, k0, "k0", cognitoIDClaims(jwt.MapClaims{"custom:role": "patient"})), http.StatusForbidden},
+		{"service with scope", "Bearer " + machine(ScopeRead+" "+ScopeWriteStatus), http.StatusNoContent},
+		{"service missing scope", "Bearer " + machine(ScopeRead), http.StatusForbidden},
+		{"service without scopes", "Bearer " + machine(""), http.StatusForbidden},
+		{"service claiming a role", "Bearer " + signToken(t, k0, "k0", tokenClaims(testInternalIssuer, jwt.MapClaims{
+			"sub": "queue-coordinator", "aud": betterAuthAudience, "role": "staff",
+		})), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPatch, "/status", strings.NewReader(""))
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestVerifyMachineTokens(t *testing.T) {
+	auth := testAuthenticator(t)
+	k0 := testKey(t, 0)
+	// a Cognito client-credentials access token: no aud, sub is the client
+	clientCredentials := func(extra jwt.MapClaims) string {
+		return signToken(t, k0, "k0", tokenClaims(testCognitoIssuer, withClaims(jwt.MapClaims{
+			"sub": "svc-client", "client_id": "svc-client", "token_use": "access",
+			"scope": ScopeRead + " " + ScopeWriteStatus,
+		}, extra)))
+	}
+
+	tests := []verifyCase{
+		{"allowed client", clientCredentials(nil),
+			identity{issuer: "cognito", userID: "svc-client", machine: true, scopes: []string{ScopeRead, ScopeWriteStatus}}},
+		{"scopes as an array", clientCredentials(jwt.MapClaims{"scope": []any{ScopeWriteQueue}}),
+			identity{issuer: "cognito", userID: "svc-client", machine: true, scopes: []string{ScopeWriteQueue}}},
+		{"role claim ignored", clientCredentials(jwt.MapClaims{"custom:role": "admin", "scope": nil}),
+			identity{issuer: "cognito", userID: "svc-client", machine: true}},
+		{"client not allowed", clientCredentials(jwt.MapClaims{"sub": "app-client", "client_id": "app-client"}), identity{}},
+		{"id token", clientCredentials(jwt.MapClaims{"token_use": "id"}), identity{}},
+		{"no token_use", clientCredentials(jwt.MapClaims{"token_use": nil}), identity{}},
+		{"foreign audience", clientCredentials(jwt.MapClaims{"aud": "other-api"}), identity{}},
+		{"accepted audience", clientCredentials(jwt.MapClaims{"aud": "app-client", "scope": ScopeRead}),
+			identity{issuer: "cognito", userID: "svc-client", machine: true, scopes: []string{ScopeRead}}},
+
+		// the subject is read from the issuer's user ID claim, not sub
+		{"client in the user ID claim", signToken(t, k0, "k0", tokenClaims(betterAuthIssuer, jwt.MapClaims{
+			"uid": "svc-2", "sub": "someone", "client_id": "svc-2", "aud": betterAuthAudience, "scope": ScopeRead,
+		})), identity{issuer: "betterauth", userID: "svc-2", machine: true, scopes: []string{ScopeRead}}},
+		{"client only in sub is a user", signToken(t, k0, "k0", tokenClaims(betterAuthIssuer, jwt.MapClaims{
+			"uid": "user-2", "sub": "svc-2", "client_id": "svc-2", "aud": betterAuthAudience, "scope": ScopeRead,
+		})), identity{issuer: "betterauth", userID: "user-2", role: RolePatient}},
+
+		{"machine-only issuer", signToken(t, k0, "k0", tokenClaims(testInternalIssuer, jwt.MapClaims{
+			"sub": "queue-coordinator", "aud": betterAuthAudience, "scope": ScopeWriteQueue,
+		})), identity{issuer: "internal", userID: "queue-coordinator", machine: true, scopes: []string{ScopeWriteQueue}}},
+		{"machine-only issuer, wrong audience", signToken(t, k0, "k0", tokenClaims(testInternalIssuer, jwt.MapClaims{
+			"sub": "queue-coordinator", "aud": "other-api", "scope": ScopeWriteQueue,
+		})), identity{}},
+	}
+	runVerifyCases(t, auth, tests)
+}
+
+func TestLocalAuthenticator(t *testing.T) {
+	const secret = "local-secret"
+	auth := NewLocalAuthenticator(secret)
+	hs256 := func(key string, claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return s
+	}
+	user := tokenClaims("anything", jwt.MapClaims{"sub": "user-1", "role": "staff"})
+
+	tests := []verifyCase{
+		{"user", hs256(secret, user), identity{issuer: "local", userID: "user-1", role: RoleStaff}},
+		{"client credentials", hs256(secret, tokenClaims("", jwt.MapClaims{
+			"sub": "svc", "client_id": "svc", "scope": ScopeRead,
+		})), identity{issuer: "local", userID: "svc", machine: true, scopes: []string{ScopeRead}}},
+		{"other secret", hs256("guessed", user), identity{}},
+		{"RS256", signToken(t, testKey(t, 0), "k0", user), identity{}},
+		{"expired", hs256(secret, withClaims(user, jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})), identity{}},
+		{"no expiry", hs256(secret, withClaims(user, jwt.MapClaims{"exp": nil})), identity{}},
+		{"no sub", hs256(secret, withClaims(user, jwt.MapClaims{"sub": nil})), identity{}},
+	}
+	runVerifyCases(t, auth, tests)
+}
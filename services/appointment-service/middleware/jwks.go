@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type jwkKey struct {
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	N   string `json:"n"` // RSA modulus (base64url)
+	E   string `json:"e"` // RSA exponent (base64url)
+}
+
+type jwksResponse struct {
+	Keys []jwkKey `json:"keys"`
+}
+
+var errUnknownKey = errors.New("no signing key matches the token's kid")
+
+// JWKS caches the RSA signing keys published at a JWKS endpoint, indexed by kid.
+// Keys are refreshed periodically by Run and on demand when a token names an unknown kid.
+// A failed refresh keeps the last good key set, so a JWKS outage only matters for keys
+// rotated in during the outage.
+type JWKS struct {
+	url    string
+	client *http.Client
+
+	// minGap rate-limits on-demand refreshes so tokens with made-up kids can't turn
+	// every request into a JWKS fetch.
+	minGap time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]*rsa.PublicKey
+	lastAttempt time.Time
+
+	refreshMu sync.Mutex // one fetch at a time
+}
+
+func NewJWKS(url string, minGap time.Duration) *JWKS {
+	return &JWKS{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		minGap: minGap,
+		keys:   map[string]*rsa.PublicKey{},
+	}
+}
+
+// Run refreshes the key set every interval until ctx is done. The first fetch happens
+// immediately; if it fails the service still starts and requests get 401 until one succeeds.
+func (j *JWKS) Run(ctx context.Context, interval time.Duration) {
+	if err := j.Refresh(ctx); err != nil {
+		log.Printf("JWKS refresh from %s failed: %v", j.url, err)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := j.Refresh(ctx); err != nil {
+				log.Printf("JWKS refresh from %s failed, keeping %d cached keys: %v", j.url, j.size(), err)
+			}
+		}
+	}
+}
+
+// Refresh fetches the key set and replaces the cache. On error the cache is left as is.
+func (j *JWKS) Refresh(ctx context.Context) error {
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+	return j.refresh(ctx)
+}
+
+// refresh does the fetch; the caller holds refreshMu.
+func (j *JWKS) refresh(ctx context.Context) error {
+	j.mu.Lock()
+	j.lastAttempt = time.Now()
+	j.mu.Unlock()
+
+	keys, err := j.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	j.keys = keys
+	j.mu.Unlock()
+	return nil
+}
+
+// Key returns the key for kid. An unknown kid triggers a refresh unless one was attempted
+// within minGap. Tokens without a kid are accepted only while the set holds a single key.
+func (j *JWKS) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	if key, ok := j.lookup(kid); ok {
+		return key, nil
+	}
+	if j.recentlyAttempted() {
+		return nil, errUnknownKey
+	}
+
+	// Requests that missed together queue here; check again under the lock so only the
+	// first of them fetches and the rest see its result (or its lastAttempt).
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+	if key, ok := j.lookup(kid); ok {
+		return key, nil
+	}
+	if j.recentlyAttempted() {
+		return nil, errUnknownKey
+	}
+	if err := j.refresh(ctx); err != nil {
+		log.Printf("JWKS refresh for unknown kid %q failed: %v", kid, err)
+	}
+	if key, ok := j.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, errUnknownKey
+}
+
+func (j *JWKS) recentlyAttempted() bool {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return time.Since(j.lastAttempt) < j.minGap
+}
+
+func (j *JWKS) lookup(kid string) (*rsa.PublicKey, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if kid == "" {
+		if len(j.keys) != 1 {
+			return nil, false
+		}
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+func (j *JWKS) size() int {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return len(j.keys)
+}
+
+func (j *JWKS) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS from %s: %w", j.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS from %s: HTTP %d", j.url, resp.StatusCode)
+	}
+
+	var body jwksResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range body.Keys {
+		if k.Kty != "RSA" || k.Use == "enc" {
+			continue
+		}
+		key, err := parseRSAKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no RSA key found in JWKS response")
+	}
+	return keys, nil
+}
+
+func parseRSAKey(k jwkKey) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode RSA modulus: %w", err)
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode RSA exponent: %w", err)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nBytes),
+		E: int(new(big.Int).SetBytes(eBytes).Int64()),
+	}, nil
+}
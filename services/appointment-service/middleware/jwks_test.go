@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	testKeysOnce sync.Once
+	testKeys     [2]*rsa.PrivateKey
+)
+
+// testKey returns one of two RSA keys shared by the tests in this package; generating
+// them is slow enough to be worth doing once.
+func testKey(t *testing.T, i int) *rsa.PrivateKey {
+	t.Helper()
+	testKeysOnce.Do(func() {
+		for j := range testKeys {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				panic(err)
+			}
+			testKeys[j] = key
+		}
+	})
+	return testKeys[i]
+}
+
+// jwksServer serves the public halves of keys (by kid) as a JWKS document, or a 500 while
+// failing is set, and counts the fetches it answers.
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	failing bool
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys map[string]*rsa.PrivateKey) *jwksServer {
+	t.Helper()
+	s := &jwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.failing {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		var body jwksResponse
+		for kid, key := range s.keys {
+			body.Keys = append(body.Keys, jwkKey{
+				Kty: "RSA", Alg: "RS256", Use: "sig", Kid: kid,
+				N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) set(keys map[string]*rsa.PrivateKey, failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys, s.failing = keys, failing
+}
+
+func TestJWKSUnknownKidRefreshes(t *testing.T) {
+	k0, k1 := testKey(t, 0), testKey(t, 1)
+	srv := newJWKSServer(t, map[string]*rsa.PrivateKey{"k0": k0})
+	j := NewJWKS(srv.URL, 0)
+	ctx := context.Background()
+
+	got, err := j.Key(ctx, "k0")
+	if err != nil || !got.Equal(&k0.PublicKey) {
+		t.Fatalf("Key(k0) = %v, %v; want k0", got, err)
+	}
+	// rotated in after the first fetch
+	srv.set(map[string]*rsa.PrivateKey{"k0": k0, "k1": k1}, false)
+	got, err = j.Key(ctx, "k1")
+	if err != nil || !got.Equal(&k1.PublicKey) {
+		t.Fatalf("Key(k1) = %v, %v; want k1", got, err)
+	}
+	if _, err := j.Key(ctx, "k0"); err != nil {
+		t.Fatalf("Key(k0) after rotation: %v", err)
+	}
+	if n := srv.fetches.Load(); n != 2 {
+		t.Errorf("fetches = %d, want 2 (cached keys need no fetch)", n)
+	}
+
+	if _, err := j.Key(ctx, "nope"); !errors.Is(err, errUnknownKey) {
+		t.Errorf("Key(nope) error = %v, want errUnknownKey", err)
+	}
+}
+
+func TestJWKSThrottlesRefresh(t *testing.T) {
+	k0 := testKey(t, 0)
+	srv := newJWKSServer(t, map[string]*rsa.PrivateKey{"k0": k0})
+	j := NewJWKS(srv.URL, time.Hour)
+	ctx := context.Background()
+
+	if _, err := j.Key(ctx, "k0"); err != nil {
+		t.Fatalf("Key(k0): %v", err)
+	}
+	for range 5 {
+		if _, err := j.Key(ctx, "made-up"); !errors.Is(err, errUnknownKey) {
+			t.Fatalf("Key(made-up) error = %v, want errUnknownKey", err)
+		}
+	}
+	if n := srv.fetches.Load(); n != 1 {
+		t.Errorf("fetches = %d, want 1: unknown kids within minGap must not refetch", n)
+	}
+
+	// Refresh (the periodic one) is not throttled
+	if err := j.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if n := srv.fetches.Load(); n != 2 {
+		t.Errorf("fetches = %d after Refresh, want 2", n)
+	}
+}
+
+func TestJWKSFailedRefreshKeepsKeys(t *testing.T) {
+	k0, k1 := testKey(t, 0), testKey(t, 1)
+	srv := newJWKSServer(t, map[string]*rsa.PrivateKey{"k0": k0})
+	j := NewJWKS(srv.URL, 0)
+	ctx := context.Background()
+
+	if err := j.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	srv.set(map[string]*rsa.PrivateKey{"k1": k1}, true)
+	if err := j.Refresh(ctx); err == nil {
+		t.Fatal("Refresh against a failing endpoint succeeded")
+	}
+	if _, err := j.Key(ctx, "k1"); !errors.Is(err, errUnknownKey) {
+		t.Errorf("Key(k1) during outage error = %v, want errUnknownKey", err)
+	}
+	got, err := j.Key(ctx, "k0")
+	if err != nil || !got.Equal(&k0.PublicKey) {
+		t.Errorf("Key(k0) after failed refresh = %v, %v; want the cached k0", got, err)
+	}
+
+	srv.set(map[string]*rsa.PrivateKey{"k1": k1}, false)
+	if _, err := j.Key(ctx, "k1"); err != nil {
+		t.Errorf("Key(k1) after recovery: %v", err)
+	}
+}
+
+func TestJWKSKeyWithoutKid(t *testing.T) {
+	k0, k1 := testKey(t, 0), testKey(t, 1)
+	srv := newJWKSServer(t, map[string]*rsa.PrivateKey{"k0": k0})
+	j := NewJWKS(srv.URL, time.Hour)
+	ctx := context.Background()
+	if err := j.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if got, err := j.Key(ctx, ""); err != nil || !got.Equal(&k0.PublicKey) {
+		t.Errorf("Key(\"\") with one key = %v, %v; want k0", got, err)
+	}
+
+	srv.set(map[string]*rsa.PrivateKey{"k0": k0, "k1": k1}, false)
+	if err := j.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if _, err := j.Key(ctx, ""); !errors.Is(err, errUnknownKey) {
+		t.Errorf("Key(\"\") with two keys error = %v, want errUnknownKey", err)
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Status string
 
@@ -13,35 +16,296 @@ const (
 	StatusNoShow     Status = "no_show"
 )
 
+// statusTransitions is the appointment lifecycle. Any move not listed here is rejected;
+// completed, cancelled and no_show are terminal.
+var statusTransitions = map[Status][]Status{
+	StatusScheduled:  {StatusCheckedIn, StatusCancelled, StatusNoShow},
+	StatusCheckedIn:  {StatusInProgress, StatusCancelled, StatusNoShow},
+	StatusInProgress: {StatusCompleted},
+	StatusCompleted:  {},
+	StatusCancelled:  {},
+	StatusNoShow:     {},
+}
+
+// Valid reports whether s is one of the known appointment statuses.
+func (s Status) Valid() bool {
+	_, ok := statusTransitions[s]
+	return ok
+}
+
+// AllowedNext returns the statuses an appointment in state s may move to.
+func (s Status) AllowedNext() []Status {
+	next := statusTransitions[s]
+	if next == nil {
+		return []Status{}
+	}
+	return next
+}
+
+// CanTransitionTo reports whether moving from s to next is a legal lifecycle step.
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal reports whether s is a terminal status.
+func (s Status) IsFinal() bool {
+	return len(statusTransitions[s]) == 0
+}
+
 type Appointment struct {
 	ID            string     `json:"id"`
 	PatientID     string     `json:"patient_id"`
-	DoctorID      *string    `json:"doctor_id"`      // null for session-based bookings
-	StartTime     *time.Time `json:"start_time"`     // null for session-based bookings
-	Session       *string    `json:"session"`        // "morning" | "afternoon" | null
-	EstimatedTime *time.Time `json:"estimated_time"` // set by ETA service
-	QueuePosition *int       `json:"queue_position"` // set by queue coordinator
+	DoctorID      *string    `json:"doctor_id"`  // null for session-based bookings
+	StartTime     *time.Time `json:"start_time"` // null for session-based bookings
+	EndTime       *time.Time `json:"end_time"`   // null for session-based bookings
+	Duration      *int       `json:"duration_minutes"`
+	Session       *string    `json:"session"`          // "morning" | "afternoon" | null
+	Date          *string    `json:"appointment_date"` // clinic day (YYYY-MM-DD); derived from start_time for doctor bookings
+	EstimatedTime *time.Time `json:"estimated_time"`   // set by ETA service via PUT /appointments/queue-snapshot
+	QueuePosition *int       `json:"queue_position"`   // set by queue coordinator via PUT /appointments/queue-snapshot
 	Notes         *string    `json:"notes"`
 	Status        Status     `json:"status"`
 	CreatedAt     time.Time  `json:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// set when the appointment is cancelled
+	CancellationReason *CancellationReason `json:"cancellation_reason"`
+	CancellationNote   *string             `json:"cancellation_note"`
+	CancelledBy        *string             `json:"cancelled_by"` // actor ID; null for system jobs
+	CancelledAt        *time.Time          `json:"cancelled_at"`
+
+	CheckedInAt    *time.Time `json:"checked_in_at"`
+	CheckedInKiosk bool       `json:"checked_in_kiosk"` // checked in at a front-desk kiosk
+	CheckedInLate  *bool      `json:"checked_in_late"`  // kiosk check-ins of doctor bookings only
 }
 
 type CreateAppointmentRequest struct {
 	PatientID string     `json:"patient_id" binding:"required"`
 	DoctorID  *string    `json:"doctor_id"`
-	StartTime *time.Time `json:"start_time"` // required for specific doctor bookings
-	Session   *string    `json:"session"`    // required for generic bookings: "morning" | "afternoon"
+	StartTime *time.Time `json:"start_time"`       // required for specific doctor bookings
+	Duration  *int       `json:"duration_minutes"` // defaults to the doctor's default_duration_minutes
+	Session   *string    `json:"session"`          // required for generic bookings: "morning" | "afternoon"
+	Date      *string    `json:"appointment_date"` // required for generic bookings: YYYY-MM-DD, today or later
+	Notes     *string    `json:"notes"`
+}
+
+// RescheduleRequest moves an appointment to a new slot. Send start_time (and optionally
+// doctor_id, defaulting to the current doctor) or session (and optionally appointment_date,
+// defaulting to the current day).
+type RescheduleRequest struct {
+	DoctorID  *string    `json:"doctor_id"`
+	StartTime *time.Time `json:"start_time"`
+	Duration  *int       `json:"duration_minutes"` // defaults to the current duration, then the doctor's default
+	Session   *string    `json:"session"`
+	Date      *string    `json:"appointment_date"`
+	Reason    *string    `json:"reason"`
+}
+
+// SessionCapacity overrides the clinic-wide default capacity for one session on one date.
+type SessionCapacity struct {
+	Date     string `json:"date" binding:"required"`    // YYYY-MM-DD
+	Session  string `json:"session" binding:"required"` // "morning" | "afternoon"
+	Capacity int    `json:"capacity" binding:"min=0"`
+}
+
+// SlotAvailability is one bookable start time in a doctor's day.
+type SlotAvailability struct {
+	StartTime time.Time `json:"start_time"`
+	Capacity  int       `json:"capacity"`
+	Booked    int       `json:"booked"`
+	Remaining int       `json:"remaining"`
+}
+
+type DoctorAvailability struct {
+	DoctorID     string             `json:"doctor_id"`
+	Date         string             `json:"date"`
+	ClosedReason *string            `json:"closed_reason,omitempty"` // set when the clinic is closed that day
+	Slots        []SlotAvailability `json:"slots"`
+}
+
+type SessionAvailability struct {
+	Session      string  `json:"session"`
+	Date         string  `json:"date"`
+	ClosedReason *string `json:"closed_reason,omitempty"`
+	Capacity     int     `json:"capacity"`
+	Booked       int     `json:"booked"`
+	Remaining    int     `json:"remaining"`
+}
+
+// WorkingHours is one weekly window in which a doctor takes bookings, in clinic time.
+type WorkingHours struct {
+	Weekday   int    `json:"weekday" binding:"min=0,max=6"` // 0 = Sunday
+	StartTime string `json:"start_time" binding:"required"` // "HH:MM"
+	EndTime   string `json:"end_time" binding:"required"`   // "HH:MM"
+}
+
+// ClinicClosure is a date the whole clinic takes no bookings, e.g. a public holiday.
+type ClinicClosure struct {
+	Date   string  `json:"date"` // YYYY-MM-DD
+	Reason *string `json:"reason"`
+}
+
+// QueueSnapshotRequest is the full queue for one doctor or session on one clinic day, as
+// computed by queue-coordinator (positions) and the ETA service (estimated times).
+// Version must increase with every snapshot of the same queue; older ones are rejected.
+type QueueSnapshotRequest struct {
+	DoctorID *string              `json:"doctor_id"`
+	Session  *string              `json:"session"`
+	Date     string               `json:"date" binding:"required"` // YYYY-MM-DD
+	Version  int64                `json:"version" binding:"required,min=1"`
+	Entries  []QueueSnapshotEntry `json:"entries" binding:"dive"`
+}
+
+// QueueSnapshotEntry places one appointment in the queue. Entries are in queue order;
+// QueuePosition defaults to the entry's 1-based index.
+type QueueSnapshotEntry struct {
+	AppointmentID string     `json:"appointment_id" binding:"required"`
+	QueuePosition *int       `json:"queue_position"`
+	EstimatedTime *time.Time `json:"estimated_time"`
+}
+
+// AppointmentPage is one page of GET /appointments. NextCursor is null on the last page.
+type AppointmentPage struct {
+	Items      []Appointment `json:"items"`
+	NextCursor *string       `json:"next_cursor"`
+}
+
+// QueueSnapshotResult lists the appointments whose queue_position or estimated_time changed,
+// including ones dropped from the queue (both cleared).
+type QueueSnapshotResult struct {
+	Version int64         `json:"version"`
+	Changed []Appointment `json:"changed"`
+}
+
+type WaitlistStatus string
+
+const (
+	WaitlistWaiting   WaitlistStatus = "waiting"
+	WaitlistPromoted  WaitlistStatus = "promoted"
+	WaitlistCancelled WaitlistStatus = "cancelled"
+)
+
+// WaitlistEntry is a patient waiting for a full doctor slot or session. When capacity frees
+// up the earliest eligible entry is booked and AppointmentID points at the new appointment.
+type WaitlistEntry struct {
+	ID            string         `json:"id"`
+	PatientID     string         `json:"patient_id"`
+	DoctorID      *string        `json:"doctor_id"`
+	StartTime     *time.Time     `json:"start_time"`
+	Duration      *int           `json:"duration_minutes"`
+	Session       *string        `json:"session"`
+	SessionDate   *string        `json:"appointment_date"` // YYYY-MM-DD, session entries only
+	Notes         *string        `json:"notes"`
+	Status        WaitlistStatus `json:"status"`
+	AppointmentID *string        `json:"appointment_id"` // set once promoted
+	CreatedAt     time.Time      `json:"created_at"`
+	PromotedAt    *time.Time     `json:"promoted_at"`
+}
+
+type CreateWaitlistRequest struct {
+	PatientID string     `json:"patient_id" binding:"required"`
+	DoctorID  *string    `json:"doctor_id"`
+	StartTime *time.Time `json:"start_time"`
+	Duration  *int       `json:"duration_minutes"`
+	Session   *string    `json:"session"`
+	Date      *string    `json:"appointment_date"`
 	Notes     *string    `json:"notes"`
 }
 
 type Doctor struct {
-	ID             string `json:"id"`
-	Name           string `json:"name"`
-	Specialization string `json:"specialization"`
-	SlotCapacity   int    `json:"slot_capacity"`
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	Specialization  string `json:"specialization"`
+	SlotCapacity    int    `json:"slot_capacity"`
+	SlotMinutes     int    `json:"slot_minutes"`             // booking granularity
+	DefaultDuration int    `json:"default_duration_minutes"` // used when a booking gives no duration
+}
+
+// DoctorSlotSettings updates a doctor's booking configuration; omitted fields are unchanged.
+type DoctorSlotSettings struct {
+	SlotCapacity    *int `json:"slot_capacity" binding:"omitempty,min=1"`
+	SlotMinutes     *int `json:"slot_minutes" binding:"omitempty,min=5,max=240"`
+	DefaultDuration *int `json:"default_duration_minutes" binding:"omitempty,min=5"`
+}
+
+// CheckInCode is a short-lived signed code, shown to the patient as a QR code, that a
+// front-desk kiosk redeems with POST /appointments/:id/check-in.
+type CheckInCode struct {
+	AppointmentID string    `json:"appointment_id"`
+	Code          string    `json:"code"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+type CheckInRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// CancellationReason is why an appointment was cancelled, for reporting on cancellations.
+type CancellationReason string
+
+const (
+	CancelPatientRequest    CancellationReason = "patient_request"
+	CancelClinicClosure     CancellationReason = "clinic_closure"
+	CancelDoctorUnavailable CancellationReason = "doctor_unavailable"
+	CancelSystemRollback    CancellationReason = "system_rollback"
+	CancelDuplicate         CancellationReason = "duplicate"
+)
+
+// CancellationReasons lists every valid CancellationReason.
+var CancellationReasons = []CancellationReason{
+	CancelPatientRequest, CancelClinicClosure, CancelDoctorUnavailable, CancelSystemRollback, CancelDuplicate,
+}
+
+// Valid reports whether r is one of CancellationReasons.
+func (r CancellationReason) Valid() bool {
+	for _, known := range CancellationReasons {
+		if r == known {
+			return true
+		}
+	}
+	return false
 }
 
 type UpdateStatusRequest struct {
-	Status Status `json:"status" binding:"required"`
+	Status     Status              `json:"status" binding:"required"`
+	Reason     *string             `json:"reason"`
+	ReasonCode *CancellationReason `json:"reason_code"` // only with status cancelled
+}
+
+// CancelRequest is the optional body of DELETE /appointments/:id. Reason is free text
+// kept alongside ReasonCode.
+type CancelRequest struct {
+	ReasonCode *CancellationReason `json:"reason_code"`
+	Reason     *string             `json:"reason"`
+}
+
+type EventType string
+
+const (
+	EventCreated       EventType = "created"
+	EventStatusChanged EventType = "status_changed"
+	EventCancelled     EventType = "cancelled"
+	EventRescheduled   EventType = "rescheduled"
+	EventPromoted      EventType = "waitlist_promoted"
+	EventJoined        EventType = "waitlist_joined"
+	EventLeft          EventType = "waitlist_left"
+)
+
+// AppointmentEvent is one row of the append-only appointment_events audit trail. Waitlist
+// events name the entry; joins and leaves have no appointment.
+type AppointmentEvent struct {
+	ID              int64           `json:"id"`
+	AppointmentID   *string         `json:"appointment_id"`
+	WaitlistEntryID *string         `json:"waitlist_entry_id,omitempty"`
+	EventType       EventType       `json:"event_type"`
+	ActorID         *string         `json:"actor_id"` // null for system-initiated changes
+	OldValue        json.RawMessage `json:"old_value"`
+	NewValue        json.RawMessage `json:"new_value"`
+	Reason          *string         `json:"reason"`
+	CreatedAt       time.Time       `json:"created_at"`
 }
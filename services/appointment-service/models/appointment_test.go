@@ -0,0 +1,50 @@
+package models
+
+import "testing"
+
+func TestStatusCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to Status
+		want     bool
+	}{
+		{StatusScheduled, StatusCheckedIn, true},
+		{StatusScheduled, StatusCancelled, true},
+		{StatusScheduled, StatusNoShow, true},
+		{StatusScheduled, StatusInProgress, false},
+		{StatusScheduled, StatusCompleted, false},
+		{StatusCheckedIn, StatusInProgress, true},
+		{StatusCheckedIn, StatusCancelled, true},
+		{StatusCheckedIn, StatusNoShow, true},
+		{StatusCheckedIn, StatusCompleted, false},
+		{StatusCheckedIn, StatusScheduled, false},
+		{StatusInProgress, StatusCompleted, true},
+		{StatusInProgress, StatusCancelled, false},
+		{StatusInProgress, StatusNoShow, false},
+		{StatusCompleted, StatusScheduled, false},
+		{StatusCancelled, StatusScheduled, false},
+		{StatusNoShow, StatusCheckedIn, false},
+		{StatusScheduled, StatusScheduled, false},
+		{Status("unknown"), StatusCheckedIn, false},
+		{StatusScheduled, Status("unknown"), false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+				t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusIsFinal(t *testing.T) {
+	for _, s := range []Status{StatusCompleted, StatusCancelled, StatusNoShow} {
+		if !s.IsFinal() {
+			t.Errorf("%s.IsFinal() = false, want true", s)
+		}
+	}
+	for _, s := range []Status{StatusScheduled, StatusCheckedIn, StatusInProgress} {
+		if s.IsFinal() {
+			t.Errorf("%s.IsFinal() = true, want false", s)
+		}
+	}
+}
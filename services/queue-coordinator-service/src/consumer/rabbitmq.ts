@@ -52,6 +52,7 @@ async function setupConsumer(url: string): Promise<void> {
     });
     await channel.bindQueue(QUEUE_NAME, EXCHANGE, "appointment.booked");
     await channel.bindQueue(QUEUE_NAME, EXCHANGE, "appointment.cancelled");
+    await channel.bindQueue(QUEUE_NAME, EXCHANGE, "appointment.checked_in");
     await channel.bindQueue(QUEUE_NAME, EXCHANGE, "consultation.completed");
     await channel.bindQueue(QUEUE_NAME, EXCHANGE, "queue.checked_in");
     await channel.bindQueue(QUEUE_NAME, EXCHANGE, "queue.removed");
@@ -97,6 +98,22 @@ async function setupConsumer(url: string): Promise<void> {
                     console.warn(`[Queue] check-in skipped for ${content.appointment_id}: ${e.message}`);
                 }
 
+            } else if (routingKey === "appointment.checked_in") {
+                // Only front-desk kiosk check-ins carry `kiosk` (and `late`, for doctor
+                // bookings); other appointment.checked_in events mirror a check-in this
+                // service already applied.
+                if (content.kiosk === true) {
+                    try {
+                        // A late patient already skipped by checkin_timeout rejoins at the back.
+                        const entry = await QueueService.checkIn(content.appointment_id);
+                        broadcastQueueUpdate(entry.appointment_id, entry);
+                        broadcastAllPatientPositions().catch(() => {});
+                        console.log(`[Queue] Kiosk check-in for appointment ${content.appointment_id}${content.late ? " (late)" : ""}`);
+                    } catch (e: any) {
+                        console.warn(`[Queue] kiosk check-in skipped for ${content.appointment_id}: ${e.message}`);
+                    }
+                }
+
             } else if (routingKey === "queue.removed") {
                 try {
                     const entry = await QueueService.removeFromQueue(content.appointment_id);